@@ -12,6 +12,8 @@ import (
 	"github.com/SUPERDBFMP/go-base/glog"
 	"github.com/SUPERDBFMP/go-base/listener"
 	"github.com/SUPERDBFMP/go-base/trace"
+
+	"github.com/sirupsen/logrus"
 )
 
 func Bootstrap(ctx context.Context, configPath string, options ...config.BootOption) {
@@ -25,7 +27,11 @@ func Bootstrap(ctx context.Context, configPath string, options ...config.BootOpt
 	for _, option := range options {
 		option(bootstrapConfig)
 	}
-	config.InitConfig(ctx, configPath, bootstrapConfig)
+	if err := config.InitConfig(ctx, configPath, bootstrapConfig); err != nil {
+		// 此时日志尚未初始化,输出到控制台
+		logrus.Errorf("加载配置失败: %v", err)
+		os.Exit(1)
+	}
 	// Init logger
 	glog.InitLogger(ctx)
 	listener.PublishApplicationEvent(ctx, &listener.AppConfigLoadedEvent{
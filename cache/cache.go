@@ -0,0 +1,387 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+	"github.com/SUPERDBFMP/go-base/glog"
+	"github.com/SUPERDBFMP/go-base/prometheus"
+	baseRedis "github.com/SUPERDBFMP/go-base/redis"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrCacheMiss 缓存中不存在该key
+var ErrCacheMiss = errors.New("cache miss")
+
+// AppNameEnvKey 缓存key的应用前缀所使用的环境变量,与日志中的应用名称相同
+const AppNameEnvKey = "APP_NAME"
+
+const (
+	defaultTTL      = 30 * time.Minute
+	defaultJitter   = 0.1
+	defaultLocalTTL = time.Minute
+)
+
+// 指标中的缓存层级与结果
+const (
+	tierLocal  = "local"
+	tierRedis  = "redis"
+	resultHit  = "hit"
+	resultMiss = "miss"
+)
+
+// Option Cache选项
+type Option func(*options)
+
+type options struct {
+	redisName  string
+	serializer Serializer
+	ttl        time.Duration
+	jitter     float64
+	localSize  int
+	localTTL   time.Duration
+}
+
+// WithRedis 使用指定名称的Redis实例,即redis-instances中的key,默认为默认实例
+func WithRedis(name string) Option {
+	return func(o *options) {
+		o.redisName = name
+	}
+}
+
+// WithSerializer 指定序列化方式,默认为JSONSerializer
+func WithSerializer(serializer Serializer) Option {
+	return func(o *options) {
+		o.serializer = serializer
+	}
+}
+
+// WithTTL 指定默认过期时间,默认30分钟,为0时不过期
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithJitter 指定过期时间的随机浮动比例,实际过期时间在 ttl 到 ttl*(1+jitter) 之间,
+// 避免同时写入的key同时过期导致缓存击穿,默认0.1,为0时不浮动
+func WithJitter(jitter float64) Option {
+	return func(o *options) {
+		o.jitter = jitter
+	}
+}
+
+// WithLocal 在Redis之前增加容量为size的进程内LRU缓存,本地缓存项在ttl后过期,为0时为1分钟。
+// 写入与删除时通过Redis发布订阅通知其他进程删除本地缓存,广播丢失时(如订阅连接断开)本地缓存最多在ttl内不一致
+func WithLocal(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.localSize = size
+		o.localTTL = ttl
+	}
+}
+
+// Cache 带类型的缓存,值按序列化方式存储在Redis中,
+// key为 APP_NAME:namespace:key,未设置APP_NAME环境变量时为 namespace:key。
+// 启用本地缓存时命中本地缓存返回的是同一个值,调用方不能修改
+type Cache[T any] struct {
+	options
+	namespace   string
+	prefix      string
+	local       *localCache[T]
+	broadcaster *broadcaster
+	group       singleflight.Group
+}
+
+// New 创建命名空间为namespace的缓存
+func New[T any](namespace string, opts ...Option) *Cache[T] {
+	options := options{
+		redisName:  config.DefaultRedis,
+		serializer: JSONSerializer{},
+		ttl:        defaultTTL,
+		jitter:     defaultJitter,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	prefix := namespace + ":"
+	if appName := os.Getenv(AppNameEnvKey); appName != "" {
+		prefix = appName + ":" + prefix
+	}
+	if options.localSize > 0 && options.localTTL <= 0 {
+		options.localTTL = defaultLocalTTL
+	}
+	c := &Cache[T]{options: options, namespace: namespace, prefix: prefix}
+	if options.localSize > 0 {
+		c.local = newLocalCache[T](options.localSize, options.localTTL)
+		c.broadcaster = getBroadcaster(options.redisName)
+		c.broadcaster.register(prefix, c.local.delete)
+	}
+	return c
+}
+
+// TTL 返回默认过期时间
+func (c *Cache[T]) TTL() time.Duration {
+	return c.ttl
+}
+
+// Key 返回缓存在Redis中的完整key
+func (c *Cache[T]) Key(key string) string {
+	return c.prefix + key
+}
+
+// client 获取缓存使用的Redis实例
+func (c *Cache[T]) client(ctx context.Context) redis.UniversalClient {
+	return baseRedis.GetNamed(ctx, c.redisName).Universal()
+}
+
+// localClient 获取Redis实例并确保已订阅失效广播,订阅失败时本次不使用本地缓存
+func (c *Cache[T]) localClient(ctx context.Context) (redis.UniversalClient, bool) {
+	client := c.client(ctx)
+	if c.local == nil {
+		return client, false
+	}
+	if err := c.broadcaster.subscribe(ctx, client); err != nil {
+		glog.Warnf(ctx, "缓存[%s]跳过本地缓存:%v", c.namespace, err)
+		return client, false
+	}
+	return client, true
+}
+
+// record 记录缓存命中指标
+func (c *Cache[T]) record(tier string, hit bool, count int) {
+	if count <= 0 {
+		return
+	}
+	result := resultMiss
+	if hit {
+		result = resultHit
+	}
+	prometheus.CacheRequestsTotal.WithLabelValues(c.namespace, tier, result).Add(float64(count))
+}
+
+// write 在管道中执行写入或删除,启用本地缓存时删除本地缓存并广播失效
+func (c *Cache[T]) write(ctx context.Context, keys []string, build func(pipe redis.Pipeliner)) error {
+	pipe := c.client(ctx).Pipeline()
+	build(pipe)
+	if c.local != nil {
+		if err := c.broadcaster.publish(ctx, pipe, c.prefix, keys); err != nil {
+			return err
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	if c.local != nil {
+		c.local.delete(keys...)
+	}
+	return err
+}
+
+// expiration 在过期时间上增加随机浮动
+func (c *Cache[T]) expiration(ttl time.Duration) time.Duration {
+	if ttl <= 0 || c.jitter <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int63n(int64(float64(ttl)*c.jitter)+1))
+}
+
+// decode 反序列化缓存值
+func (c *Cache[T]) decode(key string, data []byte) (T, error) {
+	var value T
+	if err := c.serializer.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("反序列化缓存[%s]失败:%w", key, err)
+	}
+	return value, nil
+}
+
+// Get 获取缓存,启用本地缓存时先读本地缓存,不存在时返回ErrCacheMiss
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	client, useLocal := c.localClient(ctx)
+	var version uint64
+	if useLocal {
+		if value, ok := c.local.get(key); ok {
+			c.record(tierLocal, true, 1)
+			return value, nil
+		}
+		c.record(tierLocal, false, 1)
+		version = c.local.snapshot()
+	}
+	var zero T
+	data, err := client.Get(ctx, c.Key(key)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			c.record(tierRedis, false, 1)
+			return zero, ErrCacheMiss
+		}
+		return zero, err
+	}
+	c.record(tierRedis, true, 1)
+	value, err := c.decode(key, data)
+	if err != nil {
+		return zero, err
+	}
+	if useLocal {
+		c.local.setIfUnchanged(key, value, version)
+	}
+	return value, nil
+}
+
+// Set 使用默认过期时间写入缓存
+func (c *Cache[T]) Set(ctx context.Context, key string, value T) error {
+	return c.SetWithTTL(ctx, key, value, c.ttl)
+}
+
+// SetWithTTL 使用指定的过期时间写入缓存,为0时不过期
+func (c *Cache[T]) SetWithTTL(ctx context.Context, key string, value T, ttl time.Duration) error {
+	data, err := c.serializer.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("序列化缓存[%s]失败:%w", key, err)
+	}
+	return c.write(
+		ctx, []string{key}, func(pipe redis.Pipeliner) {
+			pipe.Set(ctx, c.Key(key), data, c.expiration(ttl))
+		},
+	)
+}
+
+// MGet 批量获取缓存,返回存在的key与值,不存在的key不包含在结果中,
+// 本地缓存中不存在的key使用管道逐个GET,集群模式下key可以分布在不同的槽
+func (c *Cache[T]) MGet(ctx context.Context, keys []string) (map[string]T, error) {
+	values := make(map[string]T, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	client, useLocal := c.localClient(ctx)
+	var version uint64
+	if useLocal {
+		missing := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if value, ok := c.local.get(key); ok {
+				values[key] = value
+			} else {
+				missing = append(missing, key)
+			}
+		}
+		c.record(tierLocal, true, len(values))
+		c.record(tierLocal, false, len(missing))
+		if keys = missing; len(keys) == 0 {
+			return values, nil
+		}
+		version = c.local.snapshot()
+	}
+	pipe := client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, c.Key(key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if errors.Is(err, redis.Nil) {
+			c.record(tierRedis, false, 1)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.record(tierRedis, true, 1)
+		value, err := c.decode(keys[i], data)
+		if err != nil {
+			return nil, err
+		}
+		values[keys[i]] = value
+		if useLocal {
+			c.local.setIfUnchanged(keys[i], value, version)
+		}
+	}
+	return values, nil
+}
+
+// MSet 使用默认过期时间批量写入缓存,每个key的过期时间单独浮动
+func (c *Cache[T]) MSet(ctx context.Context, values map[string]T) error {
+	if len(values) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(values))
+	encoded := make([][]byte, 0, len(values))
+	for key, value := range values {
+		data, err := c.serializer.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("序列化缓存[%s]失败:%w", key, err)
+		}
+		keys = append(keys, key)
+		encoded = append(encoded, data)
+	}
+	return c.write(
+		ctx, keys, func(pipe redis.Pipeliner) {
+			for i, key := range keys {
+				pipe.Set(ctx, c.Key(key), encoded[i], c.expiration(c.ttl))
+			}
+		},
+	)
+}
+
+// Delete 删除缓存,key不存在时忽略
+func (c *Cache[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.write(
+		ctx, keys, func(pipe redis.Pipeliner) {
+			for _, key := range keys {
+				pipe.Del(ctx, c.Key(key))
+			}
+		},
+	)
+}
+
+// GetOrLoad 获取缓存,不存在时调用loader加载并使用默认过期时间写入缓存,loader返回错误时不写入缓存,
+// 读取或写入Redis失败时仍返回loader加载的值。
+// 同一进程中同一个key的并发加载只调用一次loader,使用第一个请求的context,其他请求共享结果
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, loader func(ctx context.Context) (T, error)) (T, error) {
+	return c.GetOrLoadWithTTL(
+		ctx, key, func(ctx context.Context) (T, time.Duration, error) {
+			value, err := loader(ctx)
+			return value, c.ttl, err
+		},
+	)
+}
+
+// GetOrLoadWithTTL 与GetOrLoad相同,loader同时返回写入缓存的过期时间,如对空结果使用较短的过期时间,
+// 过期时间为0时不过期,小于0时不写入缓存
+func (c *Cache[T]) GetOrLoadWithTTL(
+	ctx context.Context, key string, loader func(ctx context.Context) (T, time.Duration, error)) (T, error) {
+	value, err := c.Get(ctx, key)
+	if err == nil {
+		return value, nil
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		glog.Warnf(ctx, "读取缓存[%s]失败,从数据源加载:%v", c.Key(key), err)
+	}
+	result, err, _ := c.group.Do(
+		key, func() (any, error) {
+			value, ttl, err := loader(ctx)
+			if err != nil {
+				prometheus.CacheLoadsTotal.WithLabelValues(c.namespace, "error").Inc()
+				return value, err
+			}
+			prometheus.CacheLoadsTotal.WithLabelValues(c.namespace, "success").Inc()
+			if ttl < 0 {
+				return value, nil
+			}
+			if err = c.SetWithTTL(ctx, key, value, ttl); err != nil {
+				glog.Warnf(ctx, "写入缓存[%s]失败:%v", c.Key(key), err)
+			}
+			return value, nil
+		},
+	)
+	value, _ = result.(T)
+	return value, err
+}
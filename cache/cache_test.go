@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+	baseRedis "github.com/SUPERDBFMP/go-base/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// openTestRedis 启动miniredis作为默认Redis实例,测试结束后关闭
+func openTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	baseRedis.InitNamed(context.Background(), config.DefaultRedis, &config.RedisConfig{ServerAddress: mr.Addr()})
+	t.Cleanup(func() { _ = baseRedis.CloseRedis(context.Background()) })
+	return mr
+}
+
+func TestGetSetDelete(t *testing.T) {
+	mr := openTestRedis(t)
+	ctx := context.Background()
+	c := New[*user]("users", WithTTL(time.Minute), WithJitter(0))
+
+	if _, err := c.Get(ctx, "1"); !errors.Is(err, ErrCacheMiss) || errors.Is(err, redis.Nil) {
+		t.Fatalf("err = %v, want ErrCacheMiss", err)
+	}
+	if err := c.Set(ctx, "1", &user{Id: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(c.Key("1")); ttl != time.Minute {
+		t.Fatalf("ttl = %v, want 1m", ttl)
+	}
+	got, err := c.Get(ctx, "1")
+	if err != nil || !reflect.DeepEqual(got, &user{Id: 1, Name: "a"}) {
+		t.Fatalf("got %+v, err = %v", got, err)
+	}
+	if err = c.SetWithTTL(ctx, "2", &user{Id: 2}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(c.Key("2")); ttl != 0 || !mr.Exists(c.Key("2")) {
+		t.Fatalf("ttl = %v, want written without expiration", ttl)
+	}
+
+	// 删除不存在的key时忽略
+	if err = c.Delete(ctx, "1", "2", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(c.Key("1")) || mr.Exists(c.Key("2")) {
+		t.Fatal("keys should be deleted")
+	}
+	if _, err = c.Get(ctx, "1"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("err = %v, want ErrCacheMiss after delete", err)
+	}
+
+	// 反序列化失败时返回错误而不是未命中
+	mr.Set(c.Key("bad"), "{")
+	if _, err = c.Get(ctx, "bad"); err == nil || errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("err = %v, want decode error", err)
+	}
+}
+
+func TestMGetMSet(t *testing.T) {
+	mr := openTestRedis(t)
+	ctx := context.Background()
+	c := New[*user]("users", WithTTL(time.Minute), WithJitter(0.5))
+
+	if values, err := c.MGet(ctx, nil); err != nil || len(values) != 0 {
+		t.Fatalf("values = %v, err = %v, want empty", values, err)
+	}
+	if err := c.MSet(ctx, map[string]*user{"1": {Id: 1}, "2": {Id: 2}, "3": {Id: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	// 每个key的过期时间单独浮动
+	for _, key := range []string{"1", "2", "3"} {
+		if ttl := mr.TTL(c.Key(key)); ttl < time.Minute || ttl > 90*time.Second {
+			t.Fatalf("ttl of %s = %v, want between 1m and 1m30s", key, ttl)
+		}
+	}
+
+	// 不存在的key不包含在结果中
+	values, err := c.MGet(ctx, []string{"1", "4", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, map[string]*user{"1": {Id: 1}, "3": {Id: 3}}) {
+		t.Fatalf("values = %v, want keys 1 and 3", values)
+	}
+	if values, err = c.MGet(ctx, []string{"4", "5"}); err != nil || len(values) != 0 {
+		t.Fatalf("values = %v, err = %v, want empty for all missing keys", values, err)
+	}
+}
+
+func TestGetOrLoadWithTTL(t *testing.T) {
+	mr := openTestRedis(t)
+	ctx := context.Background()
+	c := New[*user]("users", WithJitter(0))
+	calls := 0
+	// loader 返回指定过期时间的用户
+	loader := func(ttl time.Duration, err error) func(ctx context.Context) (*user, time.Duration, error) {
+		return func(ctx context.Context) (*user, time.Duration, error) {
+			calls++
+			return &user{Id: 1}, ttl, err
+		}
+	}
+
+	// 过期时间小于0时不写入缓存
+	for i := 0; i < 2; i++ {
+		if got, err := c.GetOrLoadWithTTL(ctx, "1", loader(-1, nil)); err != nil || got.Id != 1 {
+			t.Fatalf("got %+v, err = %v", got, err)
+		}
+	}
+	if calls != 2 || mr.Exists(c.Key("1")) {
+		t.Fatalf("calls = %d, want loaded every time without caching", calls)
+	}
+
+	// loader返回错误时不写入缓存
+	errLoad := errors.New("load")
+	if _, err := c.GetOrLoadWithTTL(ctx, "1", loader(time.Minute, errLoad)); !errors.Is(err, errLoad) {
+		t.Fatalf("err = %v, want loader error", err)
+	}
+	if mr.Exists(c.Key("1")) {
+		t.Fatal("failed load should not be cached")
+	}
+
+	calls = 0
+	for i := 0; i < 2; i++ {
+		if got, err := c.GetOrLoadWithTTL(ctx, "1", loader(10*time.Second, nil)); err != nil || got.Id != 1 {
+			t.Fatalf("got %+v, err = %v", got, err)
+		}
+	}
+	if ttl := mr.TTL(c.Key("1")); calls != 1 || ttl != 10*time.Second {
+		t.Fatalf("calls = %d, ttl = %v, want loaded once and cached for 10s", calls, ttl)
+	}
+}
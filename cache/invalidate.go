@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/SUPERDBFMP/go-base/glog"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// invalidateChannel 本地缓存失效广播的频道,同一Redis实例上的缓存共用
+const invalidateChannel = "go-base:cache:invalidate"
+
+// invalidation 失效广播的消息
+type invalidation struct {
+	Sender string   `json:"sender"`
+	Prefix string   `json:"prefix"`
+	Keys   []string `json:"keys"`
+}
+
+// broadcaster 一个Redis实例上的失效广播订阅,收到其他进程的广播后删除对应前缀的本地缓存
+type broadcaster struct {
+	sender   string // 当前进程的标识,忽略自己发出的失效广播
+	mutex    sync.RWMutex
+	client   redis.UniversalClient // 已订阅的客户端,实例重新初始化后重新订阅
+	evictors map[string][]func(keys ...string)
+}
+
+var (
+	broadcasterMutex sync.Mutex
+	broadcasters     = make(map[string]*broadcaster)
+)
+
+// getBroadcaster 获取指定Redis实例的失效广播订阅
+func getBroadcaster(redisName string) *broadcaster {
+	broadcasterMutex.Lock()
+	defer broadcasterMutex.Unlock()
+	b, ok := broadcasters[redisName]
+	if !ok {
+		b = newBroadcaster()
+		broadcasters[redisName] = b
+	}
+	return b
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{sender: uuid.NewString(), evictors: make(map[string][]func(keys ...string))}
+}
+
+// register 注册前缀为prefix的本地缓存的删除函数
+func (b *broadcaster) register(prefix string, evict func(keys ...string)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.evictors[prefix] = append(b.evictors[prefix], evict)
+}
+
+// subscribe 确保已在client上订阅失效广播,订阅成功之前不能使用本地缓存
+func (b *broadcaster) subscribe(ctx context.Context, client redis.UniversalClient) error {
+	b.mutex.RLock()
+	subscribed := b.client == client
+	b.mutex.RUnlock()
+	if subscribed {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.client == client {
+		return nil
+	}
+	// 订阅在客户端关闭时结束,不使用请求的context
+	pubsub := client.Subscribe(context.WithoutCancel(ctx), invalidateChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return fmt.Errorf("订阅缓存失效广播失败:%w", err)
+	}
+	go func() {
+		for msg := range pubsub.Channel() {
+			b.receive(msg.Payload)
+		}
+	}()
+	b.client = client
+	return nil
+}
+
+// receive 处理失效广播,删除其他进程修改的key
+func (b *broadcaster) receive(payload string) {
+	var message invalidation
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		glog.Warnf(context.Background(), "解析缓存失效广播失败:%v", err)
+		return
+	}
+	if message.Sender == b.sender {
+		return
+	}
+	b.mutex.RLock()
+	evictors := b.evictors[message.Prefix]
+	b.mutex.RUnlock()
+	for _, evict := range evictors {
+		evict(message.Keys...)
+	}
+}
+
+// publish 在管道中添加失效广播
+func (b *broadcaster) publish(ctx context.Context, pipe redis.Pipeliner, prefix string, keys []string) error {
+	payload, err := json.Marshal(invalidation{Sender: b.sender, Prefix: prefix, Keys: keys})
+	if err != nil {
+		return err
+	}
+	pipe.Publish(ctx, invalidateChannel, payload)
+	return nil
+}
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/prometheus"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newProcessCache 创建启用本地缓存的Cache,使用单独的失效广播订阅模拟另一个进程
+func newProcessCache(namespace string) *Cache[*user] {
+	c := New[*user](namespace, WithLocal(10, time.Minute), WithJitter(0))
+	c.broadcaster = newBroadcaster()
+	c.broadcaster.register(c.prefix, c.local.delete)
+	return c
+}
+
+// localCached 本地缓存中是否存在key
+func localCached(c *Cache[*user], key string) bool {
+	_, ok := c.local.get(key)
+	return ok
+}
+
+// invalidate 模拟sender发出的失效广播
+func invalidate(t *testing.T, b *broadcaster, sender, prefix string, keys ...string) {
+	t.Helper()
+	payload, err := json.Marshal(invalidation{Sender: sender, Prefix: prefix, Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.receive(string(payload))
+}
+
+func TestInvalidation(t *testing.T) {
+	openTestRedis(t)
+	ctx := context.Background()
+	writer, reader := newProcessCache("users"), newProcessCache("users")
+	if err := writer.Set(ctx, "1", &user{Id: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reader.Get(ctx, "1"); err != nil || got.Name != "a" || !localCached(reader, "1") {
+		t.Fatalf("got %+v, err = %v, want loaded into local cache", got, err)
+	}
+
+	// 一个进程写入后通过广播删除另一个进程的本地缓存
+	if err := writer.Set(ctx, "1", &user{Id: 1, Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for localCached(reader, "1") {
+		if time.Now().After(deadline) {
+			t.Fatal("local cache should be evicted by the broadcast")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, err := reader.Get(ctx, "1"); err != nil || got.Name != "b" {
+		t.Fatalf("got %+v, err = %v, want the new value", got, err)
+	}
+
+	// 忽略自己发出的广播与其他前缀的广播
+	invalidate(t, reader.broadcaster, reader.broadcaster.sender, reader.prefix, "1")
+	invalidate(t, reader.broadcaster, writer.broadcaster.sender, "orders:", "1")
+	if !localCached(reader, "1") {
+		t.Fatal("own and other prefix broadcasts should be ignored")
+	}
+	invalidate(t, reader.broadcaster, writer.broadcaster.sender, reader.prefix, "1")
+	if localCached(reader, "1") {
+		t.Fatal("broadcast from another process should evict the key")
+	}
+
+	// 从Redis读取期间收到广播时不写入读到的旧值
+	version := reader.local.snapshot()
+	invalidate(t, reader.broadcaster, writer.broadcaster.sender, reader.prefix, "1")
+	reader.local.setIfUnchanged("1", &user{Id: 1, Name: "a"}, version)
+	if localCached(reader, "1") {
+		t.Fatal("value read before the broadcast should not be cached")
+	}
+}
+
+func TestSubscribeFailure(t *testing.T) {
+	mr := openTestRedis(t)
+	ctx := context.Background()
+	c := newProcessCache("users")
+	c.local.setIfUnchanged("1", &user{Id: 1, Name: "stale"}, c.local.snapshot())
+
+	// 订阅失败时不读本地缓存
+	mr.SetError("boom")
+	if got, err := c.Get(ctx, "1"); err == nil {
+		t.Fatalf("got %+v, want redis error instead of the local value", got)
+	}
+	if c.broadcaster.client != nil {
+		t.Fatal("broadcaster should not be marked subscribed")
+	}
+
+	mr.SetError("")
+	if got, err := c.Get(ctx, "1"); err != nil || got.Name != "stale" {
+		t.Fatalf("got %+v, err = %v, want local value after subscribing", got, err)
+	}
+}
+
+func TestGetOrLoadSingleflight(t *testing.T) {
+	openTestRedis(t)
+	ctx := context.Background()
+	c := New[*user]("users-singleflight")
+	success := prometheus.CacheLoadsTotal.WithLabelValues("users-singleflight", "success")
+	before := testutil.ToFloat64(success)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (*user, error) {
+		calls.Add(1)
+		<-release
+		return &user{Id: 1}, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := c.GetOrLoad(ctx, "1", loader)
+			if err == nil && got.Id != 1 {
+				err = errors.New("unexpected value")
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("calls = %d, want concurrent loads merged", n)
+	}
+	if n := testutil.ToFloat64(success) - before; n != 1 {
+		t.Fatalf("loads = %v, want 1", n)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	openTestRedis(t)
+	ctx := context.Background()
+	c := newProcessCache("users-metrics")
+	// requests 缓存读取次数
+	requests := func(tier, result string) float64 {
+		return testutil.ToFloat64(prometheus.CacheRequestsTotal.WithLabelValues("users-metrics", tier, result))
+	}
+	labels := [][2]string{{tierLocal, resultHit}, {tierLocal, resultMiss}, {tierRedis, resultHit}, {tierRedis, resultMiss}}
+	before := make(map[[2]string]float64, len(labels))
+	for _, label := range labels {
+		before[label] = requests(label[0], label[1])
+	}
+
+	if _, err := c.Get(ctx, "1"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("err = %v, want ErrCacheMiss", err)
+	}
+	if err := c.MSet(ctx, map[string]*user{"1": {Id: 1}, "2": {Id: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MGet(ctx, []string{"1", "2", "3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[[2]string]float64{
+		{tierLocal, resultHit}:  1, // MGet中的1
+		{tierLocal, resultMiss}: 4, // 两次Get与MGet中的2、3
+		{tierRedis, resultHit}:  2, // Get中的1与MGet中的2
+		{tierRedis, resultMiss}: 2, // 第一次Get与MGet中的3
+	}
+	for _, label := range labels {
+		if got := requests(label[0], label[1]) - before[label]; got != want[label] {
+			t.Errorf("%s %s = %v, want %v", label[0], label[1], got, want[label])
+		}
+	}
+}
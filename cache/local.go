@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// localCache 进程内的LRU缓存,超过容量时淘汰最久未访问的key,超过过期时间的key在访问时删除
+type localCache[T any] struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration // 为0时不过期,只按容量淘汰
+	entries map[string]*list.Element
+	order   *list.List // 最近访问的在最前面
+	version uint64     // 每次删除时加一,防止删除前从Redis读到的旧值在删除后写入
+	now     func() time.Time
+}
+
+// localEntry 本地缓存项
+type localEntry[T any] struct {
+	key      string
+	value    T
+	expireAt time.Time
+}
+
+func newLocalCache[T any](size int, ttl time.Duration) *localCache[T] {
+	return &localCache[T]{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// get 获取未过期的缓存项
+func (l *localCache[T]) get(key string) (T, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if element, ok := l.entries[key]; ok {
+		entry := element.Value.(*localEntry[T])
+		if l.ttl <= 0 || l.now().Before(entry.expireAt) {
+			l.order.MoveToFront(element)
+			return entry.value, true
+		}
+		l.removeElement(element)
+	}
+	var zero T
+	return zero, false
+}
+
+// snapshot 返回当前版本,从Redis读取之前获取,写入时传给setIfUnchanged
+func (l *localCache[T]) snapshot() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.version
+}
+
+// setIfUnchanged 获取版本之后没有删除过缓存项时写入,超过容量时淘汰最久未访问的key
+func (l *localCache[T]) setIfUnchanged(key string, value T, version uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.version != version {
+		return
+	}
+	expireAt := l.now().Add(l.ttl)
+	if element, ok := l.entries[key]; ok {
+		entry := element.Value.(*localEntry[T])
+		entry.value, entry.expireAt = value, expireAt
+		l.order.MoveToFront(element)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&localEntry[T]{key: key, value: value, expireAt: expireAt})
+	for l.order.Len() > l.size {
+		l.removeElement(l.order.Back())
+	}
+}
+
+// delete 删除缓存项
+func (l *localCache[T]) delete(keys ...string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.version++
+	for _, key := range keys {
+		if element, ok := l.entries[key]; ok {
+			l.removeElement(element)
+		}
+	}
+}
+
+func (l *localCache[T]) removeElement(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.entries, element.Value.(*localEntry[T]).key)
+}
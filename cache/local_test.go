@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalCache(t *testing.T) {
+	local := newLocalCache[int](2, time.Minute)
+	now := time.Now()
+	local.now = func() time.Time { return now }
+
+	local.setIfUnchanged("a", 1, local.snapshot())
+	local.setIfUnchanged("b", 2, local.snapshot())
+	local.get("a")
+	local.setIfUnchanged("c", 3, local.snapshot())
+	if _, ok := local.get("b"); ok {
+		t.Fatal("least recently used key should be evicted")
+	}
+	if value, ok := local.get("a"); !ok || value != 1 {
+		t.Fatalf("got %d, %v", value, ok)
+	}
+
+	// 读取Redis期间被删除,旧值不能写入
+	version := local.snapshot()
+	local.delete("d")
+	local.setIfUnchanged("d", 4, version)
+	if _, ok := local.get("d"); ok {
+		t.Fatal("stale value should not be cached after delete")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := local.get("a"); ok || len(local.entries) != 1 {
+		t.Fatalf("expired key should be removed, entries: %d", len(local.entries))
+	}
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Serializer 缓存值的序列化方式
+type Serializer interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONSerializer 使用JSON序列化,默认方式
+type JSONSerializer struct{}
+
+func (JSONSerializer) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONSerializer) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgpackSerializer 使用msgpack序列化,比JSON更紧凑,字段名使用msgpack标签,未指定时使用字段名
+type MsgpackSerializer struct{}
+
+func (MsgpackSerializer) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackSerializer) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// ProtoSerializer 使用protobuf序列化,缓存值的类型需为protobuf消息的指针,如 Cache[*pb.User]
+type ProtoSerializer struct{}
+
+func (ProtoSerializer) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T不是protobuf消息,无法使用protobuf序列化", v)
+	}
+	return proto.Marshal(msg)
+}
+
+// Unmarshal v为消息的指针时直接反序列化,为消息指针的指针时创建新消息后赋值
+func (ProtoSerializer) Unmarshal(data []byte, v any) error {
+	if msg, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, msg)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if msg, ok := elem.Interface().(proto.Message); ok {
+			if err := proto.Unmarshal(data, msg); err != nil {
+				return err
+			}
+			rv.Elem().Set(elem)
+			return nil
+		}
+	}
+	return fmt.Errorf("%T不是protobuf消息,无法使用protobuf反序列化", v)
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	Id   int64  `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+func TestSerializers(t *testing.T) {
+	for _, serializer := range []Serializer{JSONSerializer{}, MsgpackSerializer{}} {
+		data, err := serializer.Marshal(&user{Id: 1, Name: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got *user
+		if err = serializer.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, &user{Id: 1, Name: "test"}) {
+			t.Fatalf("%T: got %+v", serializer, got)
+		}
+	}
+
+	serializer := ProtoSerializer{}
+	data, err := serializer.Marshal(wrapperspb.String("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *wrapperspb.StringValue
+	if err = serializer.Unmarshal(data, &got); err != nil || got.GetValue() != "test" {
+		t.Fatalf("ProtoSerializer: got %v, %v", got, err)
+	}
+	if _, err = serializer.Marshal(&user{}); err == nil {
+		t.Fatal("expect error for non protobuf value")
+	}
+}
+
+func TestKeyAndExpiration(t *testing.T) {
+	t.Setenv(AppNameEnvKey, "base")
+	c := New[user]("user", WithTTL(time.Minute), WithJitter(0.5))
+	if key := c.Key("1"); key != "base:user:1" {
+		t.Fatalf("Key() = %s", key)
+	}
+	for i := 0; i < 100; i++ {
+		if ttl := c.expiration(time.Minute); ttl < time.Minute || ttl > 90*time.Second {
+			t.Fatalf("expiration() = %v", ttl)
+		}
+	}
+	if ttl := c.expiration(0); ttl != 0 {
+		t.Fatalf("expiration(0) = %v", ttl)
+	}
+}
@@ -0,0 +1,98 @@
+// go-base 命令行工具
+//
+//	go-base genkey                 生成base64编码的AES-256密钥
+//	go-base encrypt [-key-file f] [value]
+//	                               使用 APP_CONFIG_KEY、APP_CONFIG_KEY_FILE 或 -key-file 指定的密钥加密配置值,
+//	                               输出可直接写入配置的 ENC(...),未指定value时从标准输入读取
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SUPERDBFMP/go-base/config"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "encrypt":
+		err = encrypt(os.Args[2:])
+	case "genkey":
+		err = genKey()
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "go-base:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: go-base encrypt [-key-file file] [value]")
+	fmt.Fprintln(os.Stderr, "       go-base genkey")
+}
+
+// encrypt 加密配置值并输出 ENC(...)
+func encrypt(args []string) error {
+	flags := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	keyFile := flags.String("key-file", "", "密钥文件,默认读取环境变量 "+config.EncryptKeyEnvKey+" 或 "+config.EncryptKeyFileEnvKey)
+	_ = flags.Parse(args)
+	if *keyFile != "" {
+		if err := os.Setenv(config.EncryptKeyFileEnvKey, *keyFile); err != nil {
+			return err
+		}
+		if err := os.Unsetenv(config.EncryptKeyEnvKey); err != nil {
+			return err
+		}
+	}
+	key, err := config.LoadEncryptKey()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return errors.New("no key, set " + config.EncryptKeyEnvKey + " or use -key-file")
+	}
+	cipher, err := config.NewAESGCMCipher(key)
+	if err != nil {
+		return err
+	}
+	value := flags.Arg(0)
+	if flags.NArg() == 0 {
+		// 从标准输入读取,避免明文出现在shell历史中
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+	ciphertext, err := cipher.Encrypt([]byte(value))
+	if err != nil {
+		return err
+	}
+	fmt.Println(config.FormatEncrypted(ciphertext))
+	return nil
+}
+
+// genKey 生成随机的AES-256密钥
+func genKey() error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return nil
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"io/fs"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
@@ -25,6 +27,41 @@ func WithWebValidators(validators map[string]validator.Func) BootOption {
 	}
 }
 
+// WithConfigPath 指定本地配置文件路径,默认为 ./config/config.yml
+func WithConfigPath(path string) BootOption {
+	return func(bc *BootstrapConfig) {
+		bc.ConfigPath = path
+	}
+}
+
+// WithProfile 指定激活的环境,多个环境用逗号分隔,未指定时读取环境变量 APP_PROFILE
+func WithProfile(profile string) BootOption {
+	return func(bc *BootstrapConfig) {
+		bc.Profile = profile
+	}
+}
+
+// WithSources 追加配置源,优先级高于config.yml中sources配置的配置源,如测试时使用的MemorySource
+func WithSources(sources ...Source) BootOption {
+	return func(bc *BootstrapConfig) {
+		bc.Sources = append(bc.Sources, sources...)
+	}
+}
+
+// WithDecryptor 指定配置中 ENC(...) 加密值的解密器,未指定时使用环境变量 APP_CONFIG_KEY 中的密钥按AES-GCM解密
+func WithDecryptor(decryptor Decryptor) BootOption {
+	return func(bc *BootstrapConfig) {
+		bc.Decryptor = decryptor
+	}
+}
+
+// WithMigrations 指定数据库迁移文件,通常为embed.FS,配置了mysql.migrations的数据源启动时执行其中的迁移
+func WithMigrations(migrations fs.FS) BootOption {
+	return func(bc *BootstrapConfig) {
+		bc.Migrations = migrations
+	}
+}
+
 func WithCustomerConfigs(name string, configs interface{}) BootOption {
 	return func(bc *BootstrapConfig) {
 		if bc.CustomerConfigs == nil {
@@ -41,6 +78,11 @@ type BootstrapConfig struct {
 	WebMiddlewares  []gin.HandlerFunc
 	WebValidators   map[string]validator.Func
 	CustomerConfigs map[string]interface{}
+	Profile         string
+	ConfigPath      string
+	Sources         []Source
+	Decryptor       Decryptor
+	Migrations      fs.FS
 }
 
 type WebGroup struct {
@@ -4,9 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nacos-group/nacos-sdk-go/v2/clients"
 	"github.com/nacos-group/nacos-sdk-go/v2/clients/config_client"
@@ -18,70 +19,195 @@ import (
 const (
 	DefaultGroup = "DEFAULT_GROUP"
 
-	LoggerDataId     = "logger"
-	MySqlDataId      = "mysql"
-	RedisDataId      = "redis"
-	OssDataOddId     = "oss"
-	PowerJobDataId   = "powerjob"
-	GrpcDataId       = "grpc"
-	PrometheusDataId = "prometheus"
-	WebDataId        = "web"
+	LoggerDataId         = "logger"
+	MySqlDataId          = "mysql"
+	RedisDataId          = "redis"
+	OssDataOddId         = "oss"
+	PowerJobDataId       = "powerjob"
+	GrpcDataId           = "grpc"
+	PrometheusDataId     = "prometheus"
+	WebDataId            = "web"
+	DataSourcesDataId    = "datasources"
+	RedisInstancesDataId = "redis-instances"
 )
 
 var GlobalConf *GlobalConfig
+
+// NaCosClient 默认命名空间的Nacos客户端
+//
+// Deprecated: 配置段可绑定不同的命名空间,该客户端只对应默认命名空间,
+// 监听配置变更使用 RegisterConfigChangeHandler
 var NaCosClient config_client.IConfigClient
 
 // NaCosConfig 专门用于NaCos的配置信息
 type NaCosConfig struct {
-	ServerAddr string `yaml:"server-addr"` // NaCos服务器地址
-	UserName   string `yaml:"user-name"`   // NaCos用户名
-	Password   string `yaml:"password"`    // NaCos <PASSWORD>
-	Namespace  string `yaml:"namespace"`   // NaCos命名空间
+	ServerAddr string `yaml:"server-addr" validate:"required,hostname_port"` // NaCos服务器地址
+	UserName   string `yaml:"user-name"`                                     // NaCos用户名
+	Password   string `yaml:"password"`                                      // NaCos <PASSWORD>
+	Namespace  string `yaml:"namespace"`                                     // NaCos命名空间
+	// 最近一次有效配置的快照目录,Nacos不可用时从快照启动,默认为 ./config/snapshot
+	SnapshotDir string `yaml:"snapshot-dir"`
+	// 快照签名密钥,配置后快照使用HMAC-SHA256签名,否则仅使用SHA256校验
+	SnapshotKey string `yaml:"snapshot-key"`
+	// 降级模式下重新同步Nacos的间隔,单位为秒,默认10秒
+	ResyncInterval int `yaml:"resync-interval" validate:"min=0"`
+	// 配置段默认的分组,默认为DEFAULT_GROUP
+	Group string `yaml:"group"`
+	// 按data id单独指定配置段的分组与命名空间,定制配置的data id为注册时的名称
+	DataIds map[string]*NaCosDataId `yaml:"data-ids" validate:"dive"`
+	// 多个服务共用的配置,按顺序加载,靠后的覆盖靠前的,服务自身的配置覆盖所有共享配置
+	SharedDataIds []*NaCosSharedDataId `yaml:"shared-data-ids" validate:"dive"`
+}
+
+// NaCosDataId 配置段在Nacos中的分组与命名空间
+type NaCosDataId struct {
+	Group     string `yaml:"group"`     // 分组,默认使用nacos.group
+	Namespace string `yaml:"namespace"` // 命名空间,默认使用nacos.namespace
+}
+
+// NaCosSharedDataId Nacos共享配置,data id与配置段的data id相同,如 SHARED 分组中的 redis
+type NaCosSharedDataId struct {
+	DataId      string `yaml:"data-id" validate:"required"`
+	NaCosDataId `yaml:",inline"`
 }
 
 // LoggerConfig 日志配置结构体
 type LoggerConfig struct {
-	Level      string `yaml:"level"`       // 日志级别
-	Filename   string `yaml:"filename"`    // 日志文件名
-	MaxSize    int    `yaml:"max-size"`    // 日志文件最大大小
-	MaxAge     int    `yaml:"max-age"`     // 日志文件最大保存时间
-	MaxBackups int    `yaml:"max-backups"` // 日志文件最大保存个数
-	Compress   bool   `yaml:"compress"`    // 日志文件是否压缩
+	Level      string `yaml:"level" validate:"omitempty,oneofci=TRACE DEBUG INFO WARN ERROR FATAL PANIC"` // 日志级别
+	Filename   string `yaml:"filename" validate:"required"`                                               // 日志文件名
+	MaxSize    int    `yaml:"max-size" validate:"min=0"`                                                  // 日志文件最大大小
+	MaxAge     int    `yaml:"max-age" validate:"min=0"`                                                   // 日志文件最大保存时间
+	MaxBackups int    `yaml:"max-backups" validate:"min=0"`                                               // 日志文件最大保存个数
+	Compress   bool   `yaml:"compress"`                                                                   // 日志文件是否压缩
 }
 
 // MySqlConfig mysql配置
 type MySqlConfig struct {
-	Host        string `yaml:"host"`
-	Port        int    `yaml:"port"`
-	UserName    string `yaml:"user-name"`
+	Host        string `yaml:"host" validate:"required"`
+	Port        int    `yaml:"port" validate:"required,min=1,max=65535"`
+	UserName    string `yaml:"user-name" validate:"required"`
 	Password    string `yaml:"password"`
-	DbName      string `yaml:"db-name"`
-	MaxIdle     int    `yaml:"max-idle"`      //最大空闲连接
-	MaxConn     int    `yaml:"max-conn"`      //最大连接数
-	MaxLife     int    `yaml:"max-life"`      //连接生命周期，单位为分钟
-	MaxIdleTime int    `yaml:"max-idle-time"` //连接空闲时间，单位为分钟
+	DbName      string `yaml:"db-name" validate:"required"`
+	MaxIdle     int    `yaml:"max-idle" validate:"min=0,ltefield=MaxConn"` //最大空闲连接
+	MaxConn     int    `yaml:"max-conn" validate:"required,min=1"`         //最大连接数
+	MaxLife     int    `yaml:"max-life" validate:"min=0"`                  //连接生命周期，单位为分钟
+	MaxIdleTime int    `yaml:"max-idle-time" validate:"min=0"`             //连接空闲时间，单位为分钟
+	// 只读副本,配置后读请求路由到副本,事务中或强制读主库时仍使用主库
+	Replicas []*MySqlReplicaConfig `yaml:"replicas" validate:"dive"`
+	// 副本选择策略,random或round-robin,默认random
+	Policy string `yaml:"policy" validate:"omitempty,oneof=random round-robin"`
+	// 审计字段的列名,实体中存在对应列时自动填充,配置为空时不填充
+	CreateTimeColumn string `yaml:"create-time-column"` // 创建时间,默认create_time
+	UpdateTimeColumn string `yaml:"update-time-column"` // 更新时间,默认update_time
+	CreateByColumn   string `yaml:"create-by-column"`   // 创建人,默认create_by
+	UpdateByColumn   string `yaml:"update-by-column"`   // 更新人,默认update_by
+	// 逻辑删除列,如deleted或deleted_at,实体中存在该列时删除改为更新该列,查询与更新自动过滤已删除的记录,
+	// 整数或布尔类型的列删除后为1,时间类型的列删除后为删除时间,默认不启用
+	SoftDeleteColumn string `yaml:"soft-delete-column"`
+	// 慢查询阈值,单位为毫秒,超过阈值的SQL记录慢查询日志与指标,为0时不统计慢查询,默认3000
+	SlowThreshold int `yaml:"slow-threshold" validate:"min=0"`
+	// SQL日志级别,silent、error、warn或info,info时打印所有SQL,默认info
+	LogLevel string `yaml:"log-level" validate:"omitempty,oneofci=SILENT ERROR WARN INFO"`
+	// SQL日志模式,full打印代入参数的完整SQL,placeholder只打印带占位符的SQL不打印参数,默认full
+	SqlLogMode string `yaml:"sql-log-mode" validate:"omitempty,oneof=full placeholder"`
+	// full模式下需要脱敏的列名,如身份证号、手机号,这些列的参数在日志中显示为***,不区分大小写
+	SqlLogRedactColumns []string `yaml:"sql-log-redact-columns"`
+	// 未超过慢查询阈值且执行成功的SQL的日志采样比例,单位为百分比,慢查询与执行失败的SQL总是打印,默认100
+	SqlLogSampleRate int `yaml:"sql-log-sample-rate" validate:"min=0,max=100"`
+	// 启动时执行的数据库迁移,迁移文件通过WithMigrations指定,未配置时不执行
+	Migrations *MigrationsConfig `yaml:"migrations"`
 }
 
+// MigrationsConfig 数据库迁移配置
+type MigrationsConfig struct {
+	Dir         string `yaml:"dir"`                                         // 迁移文件所在目录,默认为migrations
+	Table       string `yaml:"table"`                                       // 记录已执行版本的表,默认为schema_migrations
+	Lock        string `yaml:"lock" validate:"omitempty,oneof=mysql redis"` // 迁移锁,mysql使用GET_LOCK,redis使用分布式锁,默认mysql
+	LockTimeout int    `yaml:"lock-timeout" validate:"min=0"`               // 等待迁移锁的超时时间,单位为秒,默认60秒
+	Target      int64  `yaml:"target" validate:"min=0"`                     // 目标版本,低于已执行的版本时回滚,默认只执行未执行的版本
+	DryRun      bool   `yaml:"dry-run"`                                     // 只打印待执行的SQL,不执行
+}
+
+// MySqlReplicaConfig mysql只读副本配置,未配置的字段与主库相同
+type MySqlReplicaConfig struct {
+	Host     string `yaml:"host" validate:"required"`
+	Port     int    `yaml:"port" validate:"min=0,max=65535"`
+	UserName string `yaml:"user-name"`
+	Password string `yaml:"password"`
+}
+
+// DefaultDataSource 默认数据源的名称,mysql配置即为默认数据源
+const DefaultDataSource = "default"
+
+// DataSourcesConfig 多数据源配置,key为数据源名称
+type DataSourcesConfig map[string]*MySqlConfig
+
 // RedisConfig Redis配置结构体
 type RedisConfig struct {
-	ServerAddress string `yaml:"server-address"` // Redis服务器地址
-	Password      string `yaml:"password"`       // Redis密码
-	DB            int    `yaml:"db"`             // Redis数据库
-	PoolSize      int    `yaml:"pool-size"`      // Redis连接池大小
-	MinIdleCones  int    `yaml:"min-idle-cones"` // Redis最小空闲连接数
+	// 部署模式,standalone单机、sentinel哨兵或cluster集群,默认standalone
+	Mode          string `yaml:"mode" validate:"omitempty,oneof=standalone sentinel cluster"`
+	ServerAddress string `yaml:"server-address" validate:"required_without=Addresses"` // Redis服务器地址,单机模式使用
+	// 哨兵模式下的哨兵地址或集群模式下的种子节点地址,未配置时使用server-address
+	Addresses    []string `yaml:"addresses"`
+	MasterName   string   `yaml:"master-name" validate:"required_if=Mode sentinel"` // 哨兵模式下的主节点名称
+	UserName     string   `yaml:"user-name"`                                        // Redis ACL用户名
+	Password     string   `yaml:"password"`                                         // Redis密码
+	DB           int      `yaml:"db" validate:"min=0,max=15"`                       // Redis数据库,集群模式只支持0
+	PoolSize     int      `yaml:"pool-size" validate:"min=0"`                       // Redis连接池大小
+	MinIdleCones int      `yaml:"min-idle-cones" validate:"min=0"`                  // Redis最小空闲连接数
+	// 哨兵的ACL用户名与密码,未配置时哨兵不需要认证
+	SentinelUserName string          `yaml:"sentinel-user-name"`
+	SentinelPassword string          `yaml:"sentinel-password"`
+	TLS              *RedisTLSConfig `yaml:"tls"` // TLS配置,未配置时不使用TLS
+}
+
+// DefaultRedis 默认Redis实例的名称,redis配置即为默认实例
+const DefaultRedis = "default"
+
+// RedisInstancesConfig 多Redis实例配置,key为实例名称
+type RedisInstancesConfig map[string]*RedisConfig
+
+// RedisTLSConfig Redis TLS配置
+type RedisTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`                                    // 是否启用TLS
+	CaFile             string `yaml:"ca-file"`                                    // 校验服务端证书的CA证书文件,默认使用系统CA
+	CertFile           string `yaml:"cert-file" validate:"required_with=KeyFile"` // 双向认证的客户端证书文件
+	KeyFile            string `yaml:"key-file" validate:"required_with=CertFile"` // 双向认证的客户端私钥文件
+	ServerName         string `yaml:"server-name"`                                // 校验服务端证书的域名,默认为连接地址中的主机名
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify"`                       // 是否跳过服务端证书校验,仅用于测试环境
+}
+
+// IdGenConfig 分布式ID生成配置
+type IdGenConfig struct {
+	// 机器ID来源,config使用worker-id,pod使用POD_NAME或主机名的哈希,redis从Redis租用空闲的机器ID,
+	// 默认配置了worker-id时为config,否则为pod
+	WorkerIdSource string `yaml:"worker-id-source" validate:"omitempty,oneof=config pod redis"`
+	WorkerId       *int64 `yaml:"worker-id" validate:"required_if=WorkerIdSource config,omitempty,min=0,max=1023"`
+	// 起始时间,格式为2006-01-02,默认为2024-01-01,上线后不能修改
+	Epoch string `yaml:"epoch" validate:"omitempty,datetime=2006-01-02"`
+	// 时钟回拨时最多等待的毫秒数,超过时生成ID失败,默认为5毫秒
+	MaxBackwardMs int `yaml:"max-backward-ms" validate:"min=0"`
+	// 从Redis租用机器ID时使用的key前缀,默认为go-base:idgen:worker
+	LeaseKey string `yaml:"lease-key"`
 }
 
 type WebServerConfig struct {
-	Port        string `yaml:"port"`
-	ContextPath string `yaml:"context-path"`
+	Port        string `yaml:"port" validate:"required,numeric"`
+	ContextPath string `yaml:"context-path" validate:"omitempty,startswith=/"`
 }
 
 type GlobalConfig struct {
 	NaCos     *NaCosConfig     `yaml:"nacos"`
+	Sources   []*SourceConfig  `yaml:"sources" validate:"dive"` // 配置源,未配置时若配置了nacos则使用Nacos配置源
 	WebServer *WebServerConfig `yaml:"web-server"`
 	Logger    *LoggerConfig    `yaml:"logger"`
 	MySQL     *MySqlConfig     `yaml:"mysql"`
 	Redis     *RedisConfig     `yaml:"redis"`
+	// 多数据源,每个数据源未配置的key使用mysql的内置默认配置
+	DataSources DataSourcesConfig `yaml:"datasources" validate:"dive"`
+	// 多Redis实例,如缓存、会话与锁分别使用不同的实例,每个实例未配置的key使用redis的内置默认配置
+	RedisInstances RedisInstancesConfig `yaml:"redis-instances" validate:"dive"`
+	IdGen          *IdGenConfig         `yaml:"id-gen"`
 }
 
 type CustomConfig struct {
@@ -113,190 +239,300 @@ func WithRedisConfig(redis *RedisConfig) Option {
 	}
 }
 
-// 初始化配置
-func InitConfig(ctx context.Context, localConfigPath string, bootConfig *BootstrapConfig) {
+// Load 加载配置,加载成功后同时设置GlobalConf
+// 配置文件路径通过WithConfigPath指定,默认为 ./config/config.yml
+func Load(ctx context.Context, opts ...BootOption) (*GlobalConfig, error) {
+	bootConfig := &BootstrapConfig{}
+	for _, opt := range opts {
+		opt(bootConfig)
+	}
+	return loadConfig(ctx, bootConfig)
+}
+
+// InitConfig 初始化配置
+func InitConfig(ctx context.Context, localConfigPath string, bootConfig *BootstrapConfig) error {
+	if localConfigPath != "" {
+		bootConfig.ConfigPath = localConfigPath
+	}
+	_, err := loadConfig(ctx, bootConfig)
+	return err
+}
+
+func loadConfig(ctx context.Context, bootConfig *BootstrapConfig) (*GlobalConfig, error) {
+	localConfigPath := bootConfig.ConfigPath
 	if localConfigPath == "" {
 		localConfigPath = "./config/config.yml"
 	}
-	fileByte, err := os.ReadFile(localConfigPath)
+	hints := []reflect.Type{reflect.TypeOf(GlobalConfig{})}
+	for _, customConfig := range bootConfig.CustomerConfigs {
+		hints = append(hints, reflect.TypeOf(customConfig))
+	}
+	// 基础配置 config.yml 叠加环境配置 config-{profile}.yml
+	tree, err := readLayeredConfig(localConfigPath, resolveProfiles(bootConfig), hints...)
 	if err != nil {
-		_ = fmt.Errorf("read config file path:[%s],errs,%v", localConfigPath, err)
-		panic(err)
+		return nil, err
 	}
-	GlobalConf = new(GlobalConfig)
-	err = yaml.Unmarshal(fileByte, GlobalConf)
+	// 解析 ${ENV_NAME:default} 占位符并应用 APP_ 前缀的环境变量覆盖,解密 ENC(...) 加密值
+	setDecryptor(bootConfig.Decryptor)
+	overridden, err := resolveTree(tree, nil, hints...)
 	if err != nil {
-		_ = fmt.Errorf("parse config file path:[%s],errs,%v", localConfigPath, err)
-		panic(err)
-		//glog.Warnf(ctx,"Parse yaml config[%s] from Nacos errs: %v,use default config", content, errs)
+		return nil, err
 	}
-	//定制配置
-	for name, customConfig := range bootConfig.CustomerConfigs {
-		err = yaml.Unmarshal(fileByte, customConfig)
-		if err != nil {
-			panic(fmt.Sprintf("解析%s配置失败: %s", name, err))
+	fileByte, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	conf := new(GlobalConfig)
+	if err = yaml.Unmarshal(fileByte, conf); err != nil {
+		return nil, &ParseError{Source: overrideSource(localConfigPath, overridden), Err: err}
+	}
+	// 配置源在各配置段加载前校验,避免使用错误的配置源
+	if err = validateSection(GlobalSection, &GlobalConfig{NaCos: conf.NaCos, Sources: conf.Sources}, bootConfig.WebValidators); err != nil {
+		return nil, err
+	}
+	sources, err := newSources(conf, bootConfig)
+	if err != nil {
+		return nil, err
+	}
+	loaded := false
+	defer func() {
+		if !loaded {
+			closeSources(sources[:len(sources)-len(bootConfig.Sources)])
 		}
-		//content, err := NaCosClient.GetConfig(
-		//	vo.ConfigParam{
-		//		DataId: customConfig.Name,
-		//		Group:  DefaultGroup,
-		//	},
-		//)
-		//if err != nil {
-		//	panic(fmt.Sprintf("从Nacos获取%s配置失败: %s", customConfig.Name, err))
-		//}
-		//if content == "" {
-		//	panic(fmt.Sprintf("从Nacos获取%s配置为空", customConfig.Name))
-		//}
-	}
-	if GlobalConf.NaCos != nil {
-		err = initNaCos(GlobalConf.NaCos)
+	}()
+	// 各配置段按 默认配置 < 本地配置 < 配置源 的优先级加载
+	sections, err := newSections(bootConfig, sources)
+	if err != nil {
+		return nil, err
+	}
+	kinds := make(map[string]SourceKind)
+	for _, s := range sections {
+		value, kind, err := s.load(tree)
 		if err != nil {
-			panic(fmt.Sprintf("初始化Nacos客户端错误: %s", err))
+			return nil, err
 		}
-		loadLoggerConfig()
-		loadMysqlConfig()
-		loadRedisConfig()
-		for name, customConfig := range bootConfig.CustomerConfigs {
-			loadCustomConfig(name, customConfig)
+		if value == nil {
+			continue
 		}
+		s.apply(conf, value)
+		kinds[s.dataId] = kind
 	}
-}
-
-// 初始化NaCos
-func initNaCos(config *NaCosConfig) error {
-	if config.ServerAddr == "" {
-		return errors.New("nacos服务器地址未配置")
+	// 所有配置加载完成后统一校验,汇总所有不合法的字段,仅有默认配置的配置段不校验
+	if err = Validate(withoutDefaultSections(conf, kinds), bootConfig.CustomerConfigs, bootConfig.WebValidators); err != nil {
+		return nil, err
 	}
-
-	address := strings.Split(config.ServerAddr, ":")
-	if port, err := strconv.Atoi(address[1]); err != nil {
-		return fmt.Errorf("nacos服务器端口%s配置错误", address[1])
-	} else {
-
-		// Nacos服务器配置
-		serverConfigs := []constant.ServerConfig{{IpAddr: address[0], Port: uint64(port)}}
-
-		// 客户端配置
-		clientConfig := constant.ClientConfig{
-			Username:            config.UserName,
-			Password:            config.Password,
-			NamespaceId:         config.Namespace,
-			NotLoadCacheAtStart: true,
+	loaded = true
+	replaceSources(sources)
+	changeMutex.Lock()
+	GlobalConf = conf
+	sectionSources = kinds
+	changeMutex.Unlock()
+	if len(sources) > 0 {
+		for _, s := range sections {
+			s.saveSnapshots()
 		}
-
-		// 创建配置客户端
-		NaCosClient, err = clients.NewConfigClient(
-			vo.NacosClientParam{
-				ClientConfig:  &clientConfig,
-				ServerConfigs: serverConfigs,
-			},
-		)
-		return err
+		// 监听各配置段的变更
+		if err = watchSections(sections, bootConfig.WebValidators); err != nil {
+			return nil, err
+		}
+		interval := defaultResyncInterval
+		if conf.NaCos != nil && conf.NaCos.ResyncInterval > 0 {
+			interval = conf.NaCos.ResyncInterval
+		}
+		startResync(sections, time.Duration(interval)*time.Second)
 	}
+	return conf, nil
 }
 
-// 默认配置
-var defaultLoggerParam = &LoggerConfig{
-	Filename:   "./base.log",
-	MaxSize:    50,
-	MaxBackups: 30,
-	MaxAge:     30,
-	Compress:   true,
-	Level:      "INFO",
+// naCosSource Nacos配置源,Nacos不可用时使用本地快照,每个命名空间使用一个Nacos客户端
+type naCosSource struct {
+	client     config_client.IConfigClient
+	snapshots  *snapshotStore
+	conf       *NaCosConfig
+	namespaces map[string]*naCosSource // 其他命名空间的配置源,仅nacos.namespace的配置源持有
 }
 
-// 加载日志配置
-func loadLoggerConfig() {
-	if GlobalConf.NaCos == nil {
-		return
-	}
-	// 从Nacos获取并解析PowerJob配置
-	content, err := NaCosClient.GetConfig(
-		vo.ConfigParam{
-			DataId: LoggerDataId,
-			Group:  DefaultGroup,
-		},
-	)
+// NewNaCosSource 根据Nacos配置创建Nacos配置源
+func NewNaCosSource(config *NaCosConfig) (Source, error) {
+	return newNaCosSource(config)
+}
+
+func newNaCosSource(config *NaCosConfig) (*naCosSource, error) {
+	client, err := newNaCosConfigClient(config)
 	if err != nil {
-		//logrus.Warnf("Fetch config from Nacos with data id[%s] errs:%v,use default config", LoggerDataId, errs)
-		WithLoggerConfig(defaultLoggerParam)
-		return
+		return nil, err
 	}
-	if content == "" {
-		//logrus.Warnf("Fetch config from Nacos with data id[%s] is blank,use default config", LoggerDataId)
-		WithLoggerConfig(defaultLoggerParam)
-		return
+	return &naCosSource{
+		client:     client,
+		snapshots:  newSnapshotStore(config),
+		conf:       config,
+		namespaces: make(map[string]*naCosSource),
+	}, nil
+}
+
+// namespace 返回指定命名空间的配置源,为空时为nacos.namespace
+func (n *naCosSource) namespace(namespace string) (*naCosSource, error) {
+	if namespace == "" || namespace == n.conf.Namespace {
+		return n, nil
 	}
-	var config LoggerConfig
-	if err = yaml.Unmarshal([]byte(content), &config); err != nil {
-		//logrus.Warnf("Parse yaml config[%s] from Nacos errs: %v,use default config", content, errs)
-		WithLoggerConfig(&config)
+	if source, ok := n.namespaces[namespace]; ok {
+		return source, nil
 	}
+	conf := *n.conf
+	conf.Namespace = namespace
+	source, err := newNaCosSource(&conf)
+	if err != nil {
+		return nil, err
+	}
+	n.namespaces[namespace] = source
+	return source, nil
 }
 
-func loadCustomConfig(name string, config interface{}) {
-	content, err := NaCosClient.GetConfig(vo.ConfigParam{DataId: name, Group: DefaultGroup})
-	if err != nil {
-		panic(fmt.Sprintf("Fetch config from Nacos with data id[%s]errs:%s", name, err))
+// items 配置段在Nacos中的配置项,共享配置在前,服务自身的配置在后
+func (n *naCosSource) items(dataId string) ([]sourceItem, error) {
+	group := n.conf.Group
+	if group == "" {
+		group = DefaultGroup
 	}
-	if content == "" {
-		//logrus.Warnf
-		return
+	bindings := make([]*NaCosSharedDataId, 0, 1)
+	for _, shared := range n.conf.SharedDataIds {
+		if shared.DataId == dataId {
+			bindings = append(bindings, shared)
+		}
+	}
+	own := &NaCosSharedDataId{DataId: dataId}
+	if binding := n.conf.DataIds[dataId]; binding != nil {
+		own.NaCosDataId = *binding
 	}
-	if err = yaml.Unmarshal([]byte(content), config); err != nil {
-		panic(fmt.Sprintf("Fetch config from Nacos with data id[%s]errs:%s", name, err))
+	bindings = append(bindings, own)
+	items := make([]sourceItem, 0, len(bindings))
+	for _, binding := range bindings {
+		source, err := n.namespace(binding.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("初始化Nacos命名空间%s的客户端错误: %w", binding.Namespace, err)
+		}
+		item := sourceItem{source: source, dataId: dataId, group: binding.Group}
+		if item.group == "" {
+			item.group = group
+		}
+		items = append(items, item)
 	}
+	return items, nil
 }
 
-// 加载MySQL配置
-func loadMysqlConfig() {
-	content, err := NaCosClient.GetConfig(vo.ConfigParam{DataId: MySqlDataId, Group: DefaultGroup})
+// newNaCosConfigClient 创建Nacos配置客户端
+func newNaCosConfigClient(config *NaCosConfig) (config_client.IConfigClient, error) {
+	if config.ServerAddr == "" {
+		return nil, errors.New("nacos服务器地址未配置")
+	}
+
+	host, portStr, found := strings.Cut(config.ServerAddr, ":")
+	if !found {
+		return nil, fmt.Errorf("nacos服务器地址%s缺少端口", config.ServerAddr)
+	}
+	port, err := strconv.Atoi(portStr)
 	if err != nil {
-		panic(fmt.Sprintf("Fetch config from Nacos with data id[%s]errs:%s", MySqlDataId, err))
+		return nil, fmt.Errorf("nacos服务器端口%s配置错误", portStr)
 	}
-	if content == "" {
-		//logrus.Warnf("Fetch config from Nacos with data id[%s] is blank", MySqlDataId)
-		return
+
+	// Nacos服务器配置
+	serverConfigs := []constant.ServerConfig{{IpAddr: host, Port: uint64(port)}}
+
+	// 客户端配置
+	clientConfig := constant.ClientConfig{
+		Username:            config.UserName,
+		Password:            config.Password,
+		NamespaceId:         config.Namespace,
+		NotLoadCacheAtStart: true,
 	}
 
-	var config MySqlConfig
-	if err = yaml.Unmarshal([]byte(content), &config); err != nil {
-		panic(fmt.Sprintf("Parse yaml config[%s] from Nacos errs: %v", content, err))
+	// 创建配置客户端
+	client, err := newNaCosClient(
+		vo.NacosClientParam{
+			ClientConfig:  &clientConfig,
+			ServerConfigs: serverConfigs,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSourceUnreachable, err)
 	}
-	WithMySqlConfig(&config)
+	return client, nil
 }
 
-// 加载Redis配置
-func loadRedisConfig() {
-	content, err := NaCosClient.GetConfig(vo.ConfigParam{DataId: RedisDataId, Group: DefaultGroup})
+// newNaCosClient 创建Nacos配置客户端,测试时可替换
+var newNaCosClient = clients.NewConfigClient
+
+func (n *naCosSource) Name() string {
+	return string(SourceNaCos)
+}
+
+// Get 从Nacos获取配置内容
+func (n *naCosSource) Get(dataId, group string) (string, error) {
+	content, err := n.client.GetConfig(vo.ConfigParam{DataId: dataId, Group: group})
 	if err != nil {
-		panic(fmt.Sprintf("Fetch config from Nacos with data id[%s]errs:%s", RedisDataId, err))
+		return "", fmt.Errorf("%w: fetch config from Nacos with data id[%s] errs:%v", ErrSourceUnreachable, dataId, err)
 	}
 	if content == "" {
-		//logrus.Warnf("Fetch config from Nacos with data id[%s] is blank", MySqlDataId)
-		return
+		return "", fmt.Errorf("%w: nacos data id[%s]", ErrSourceDataEmpty, dataId)
 	}
+	return content, nil
+}
 
-	var config RedisConfig
-	if err = yaml.Unmarshal([]byte(content), &config); err != nil {
-		panic(fmt.Sprintf("Parse yaml config[%s] from Nacos errs: %v", content, err))
+func (n *naCosSource) Watch(dataId, group string, onChange ChangeHandler) error {
+	return listenNaCosConfig(n.client, dataId, group, onChange)
+}
+
+func (n *naCosSource) Close() error {
+	for _, source := range n.namespaces {
+		source.client.CloseClient()
 	}
-	WithRedisConfig(&config)
+	n.client.CloseClient()
+	return nil
+}
+
+func (n *naCosSource) snapshotStore() *snapshotStore {
+	return n.snapshots
 }
 
 // ChangeHandler 配置变更处理器函数
 type ChangeHandler func(data string)
 
-// RegisterConfigChangeHandler 注册配置变更监听
-func RegisterConfigChangeHandler(dataId, group string, handler ChangeHandler) {
-	if err := NaCosClient.ListenConfig(
+// RegisterConfigChangeHandler 在当前生效的各配置源中监听data id的变更,
+// Nacos配置源使用data id绑定的命名空间与分组,group不为空时使用指定的分组
+func RegisterConfigChangeHandler(dataId, group string, handler ChangeHandler) error {
+	sourceMutex.Lock()
+	sources := append([]Source{}, activeSources...)
+	sourceMutex.Unlock()
+	if len(sources) == 0 {
+		return errors.New("没有生效的配置源")
+	}
+	for _, source := range sources {
+		items, err := sourceItems(source, dataId)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if group != "" {
+				item.group = group
+			}
+			if err = item.source.Watch(item.dataId, item.group, handler); err != nil {
+				return fmt.Errorf("watch config data id[%s] from %s errs: %w", dataId, source.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// listenNaCosConfig 监听Nacos配置变更
+func listenNaCosConfig(client config_client.IConfigClient, dataId, group string, handler ChangeHandler) error {
+	if err := client.ListenConfig(
 		vo.ConfigParam{
 			DataId:   dataId,
 			Group:    group,
 			OnChange: func(namespace, group, dataId, data string) { handler(data) },
 		},
 	); err != nil {
-		panic("register nacos config change listener failed, error: " + err.Error())
+		return fmt.Errorf("register nacos config change listener failed: %w", err)
 	}
+	return nil
 }
@@ -1,7 +1,587 @@
 package config
 
-import "testing"
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nacos-group/nacos-sdk-go/v2/clients"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/config_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/model"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+)
 
 func TestConfig(t *testing.T) {
-	InitConfig("../config.yml")
+	if err := InitConfig(context.Background(), "../config.yml", &BootstrapConfig{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+mysql:
+  host: 10.0.0.1
+  port: 3306
+  user-name: root
+  db-name: base
+  max-conn: 20
+custom:
+  name: base
+`)
+	writeFile(t, filepath.Join(dir, "config-dev.yml"), `
+mysql:
+  host: 127.0.0.1
+custom:
+  name: dev
+`)
+	type customConfig struct {
+		Custom struct {
+			Name string `yaml:"name"`
+		} `yaml:"custom"`
+	}
+	custom := &customConfig{}
+	t.Setenv(ProfileEnvKey, "dev")
+	_, err := Load(
+		context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")), WithCustomerConfigs("custom", custom),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GlobalConf.MySQL.Host != "127.0.0.1" {
+		t.Fatalf("expect profile host 127.0.0.1, got %s", GlobalConf.MySQL.Host)
+	}
+	if GlobalConf.MySQL.Port != 3306 || GlobalConf.MySQL.DbName != "base" {
+		t.Fatalf("expect base mysql keys kept, got %+v", GlobalConf.MySQL)
+	}
+	if custom.Custom.Name != "dev" {
+		t.Fatalf("expect custom config merged, got %s", custom.Custom.Name)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnvConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+mysql:
+  host: ${TEST_DB_HOST:localhost}
+  port: ${TEST_DB_PORT:3306}
+  user-name: root
+  password: ${TEST_DB_PASSWORD}
+  db-name: base
+`)
+	t.Setenv("TEST_DB_HOST", "10.0.0.2")
+	t.Setenv("TEST_DB_PASSWORD", "007")
+	t.Setenv("APP_MYSQL_MAX_CONN", "50")
+	t.Setenv("APP_MYSQL_DB_NAME", "order")
+	conf, err := Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mysql := conf.MySQL
+	if mysql.Host != "10.0.0.2" || mysql.Port != 3306 || mysql.Password != "007" {
+		t.Fatalf("expect placeholders resolved, got %+v", mysql)
+	}
+	if mysql.MaxConn != 50 || mysql.DbName != "order" {
+		t.Fatalf("expect env overrides applied, got %+v", mysql)
+	}
+
+	var logger LoggerConfig
+	t.Setenv("APP_LOGGER_LEVEL", "DEBUG")
+	if err := UnmarshalSection("filename: logs/${TEST_POD:default}.log\nlevel: INFO", "logger", &logger); err != nil {
+		t.Fatal(err)
+	}
+	if logger.Filename != "logs/default.log" || logger.Level != "DEBUG" {
+		t.Fatalf("expect section resolved, got %+v", logger)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Load(context.Background(), WithConfigPath(filepath.Join(dir, "missing.yml")))
+	if !errors.Is(err, ErrConfigNotFound) {
+		t.Fatalf("expect ErrConfigNotFound, got %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "config.yml"), "mysql:\n  host: localhost\n  port: abc\n")
+	_, err = Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expect ParseError, got %v", err)
+	}
+	if parseErr.Line != 3 || parseErr.Column != 9 {
+		t.Fatalf("expect error at line 3 column 9, got %d:%d", parseErr.Line, parseErr.Column)
+	}
+
+	writeFile(t, filepath.Join(dir, "config.yml"), "mysql:\n  host: [localhost\n")
+	_, err = Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	if !errors.As(err, &parseErr) || parseErr.Line == 0 {
+		t.Fatalf("expect ParseError with line, got %v", err)
+	}
+
+	// 只有应用了环境变量覆盖时错误来源才标记为环境变量覆盖,占位符在读取文件时已按行列号校验
+	path := filepath.Join(dir, "config.yml")
+	writeFile(t, path, "mysql:\n  host: localhost\n  port: 3306\n")
+	t.Setenv("APP_MYSQL_PORT", "abc")
+	_, err = Load(context.Background(), WithConfigPath(path))
+	if !errors.As(err, &parseErr) || parseErr.Source != path+" (env override)" {
+		t.Fatalf("expect ParseError from env override, got %v", err)
+	}
+	if source := overrideSource(path, false); source != path {
+		t.Fatalf("expect plain path without override, got %s", source)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+web-server:
+  port: http
+mysql:
+  host: localhost
+  port: 3306
+  user-name: root
+  db-name: base
+  max-conn: 0
+`)
+	type customConfig struct {
+		Custom struct {
+			Url string `yaml:"url" validate:"required,url"`
+		} `yaml:"custom"`
+	}
+	_, err := Load(
+		context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")),
+		WithCustomerConfigs("custom", &customConfig{}),
+	)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expect ValidationError, got %v", err)
+	}
+	fields := make(map[string]string)
+	for _, field := range validationErr.Fields {
+		fields[field.Section+":"+field.Field] = field.Rule
+	}
+	expected := map[string]string{
+		"global:web-server.port": "numeric",
+		"global:mysql.max-conn":  "required",
+		"global:mysql.max-idle":  "ltefield",
+		"custom:custom.url":      "required",
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("expect %d invalid fields, got %v", len(expected), validationErr)
+	}
+	for key, rule := range expected {
+		if fields[key] != rule {
+			t.Fatalf("expect %s to fail %s, got %v", key, rule, validationErr)
+		}
+	}
+}
+
+func TestSectionChange(t *testing.T) {
+	GlobalConf = &GlobalConfig{MySQL: &MySqlConfig{Host: "localhost", Port: 3306, UserName: "root", DbName: "base", MaxConn: 10}}
+	var changes []*ConfigChange
+	AddConfigChangeListener(func(ctx context.Context, change *ConfigChange) { changes = append(changes, change) })
+	mysqlSection := newBuiltinSections()[1]
+	mysqlSection.base = map[string]interface{}{"host": "localhost", "port": 3306, "user-name": "root", "db-name": "base"}
+	mysqlRemote := &remote{sourceItem: sourceItem{source: NewMemorySource(), dataId: MySqlDataId, group: DefaultGroup}}
+	mysqlSection.remotes = []*remote{mysqlRemote}
+
+	onRemoteChange(mysqlSection, mysqlRemote, "max-conn: 0", false)
+	if len(changes) != 0 || GlobalConf.MySQL.MaxConn != 10 {
+		t.Fatalf("expect invalid config ignored, got %+v", GlobalConf.MySQL)
+	}
+
+	onRemoteChange(mysqlSection, mysqlRemote, "max-conn: 50\nmax-idle: 5", false)
+	if len(changes) != 1 || GlobalConf.MySQL.MaxConn != 50 {
+		t.Fatalf("expect change applied, got %+v", GlobalConf.MySQL)
+	}
+	change := changes[0]
+	if change.DataId != MySqlDataId || change.Old.(*MySqlConfig).MaxConn != 10 {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	if len(change.ChangedKeys) != 2 || change.ChangedKeys[0] != "max-conn" || change.ChangedKeys[1] != "max-idle" {
+		t.Fatalf("unexpected changed keys %v", change.ChangedKeys)
+	}
+}
+
+func TestSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+mysql:
+  host: localhost
+  user-name: root
+  db-name: base
+`)
+	conf, err := Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := Sources()
+	if sources[LoggerDataId] != SourceDefault || sources[MySqlDataId] != SourceLocal || sources[RedisDataId] != SourceDefault {
+		t.Fatalf("unexpected sources %v", sources)
+	}
+	if _, ok := sources[WebDataId]; ok || conf.WebServer != nil {
+		t.Fatalf("expect web section not configured, got %v", sources)
+	}
+	if conf.Logger == nil || conf.Logger.Level != "INFO" || conf.Redis == nil || conf.Redis.PoolSize != 10 {
+		t.Fatalf("expect default logger and redis config, got %+v %+v", conf.Logger, conf.Redis)
+	}
+	// 本地配置逐key覆盖默认配置
+	if conf.MySQL.Host != "localhost" || conf.MySQL.Port != 3306 || conf.MySQL.MaxConn != 20 {
+		t.Fatalf("expect local mysql merged with defaults, got %+v", conf.MySQL)
+	}
+	if !IsConfigured(MySqlDataId) || IsConfigured(RedisDataId) {
+		t.Fatalf("unexpected configured sections %v", sources)
+	}
+}
+
+func TestConfigSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+sources:
+  - type: dir
+    path: `+filepath.Join(dir, "remote")+`
+    poll-interval: 1
+mysql:
+  host: localhost
+  user-name: root
+  db-name: base
+`)
+	writeFile(t, filepath.Join(dir, "remote", "mysql.yml"), "host: dir-db\nmax-conn: 30")
+	memory := NewMemorySource()
+	memory.Set(MySqlDataId, DefaultGroup, "max-conn: 40")
+	conf, err := Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")), WithSources(memory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 靠后的配置源逐key覆盖靠前的配置源
+	if conf.MySQL.Host != "dir-db" || conf.MySQL.MaxConn != 40 || Sources()[MySqlDataId] != SourceMemory {
+		t.Fatalf("expect mysql merged from dir and memory sources, got %+v %v", conf.MySQL, Sources())
+	}
+
+	memory.Set(MySqlDataId, DefaultGroup, "max-conn: 50")
+	if GlobalConf.MySQL.MaxConn != 50 {
+		t.Fatalf("expect memory source change applied, got %+v", GlobalConf.MySQL)
+	}
+
+	writeFile(t, filepath.Join(dir, "remote", "redis.yml"), "server-address: dir-redis:6379")
+	writeFile(t, filepath.Join(dir, "remote", "mysql.yml"), "host: dir-db-2")
+	// 目录配置源在轮询协程中生效配置,加锁读取
+	current := func() GlobalConfig {
+		changeMutex.Lock()
+		defer changeMutex.Unlock()
+		return *GlobalConf
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for (current().MySQL.Host != "dir-db-2" || current().Redis.ServerAddress == "") && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if conf := current(); conf.MySQL.Host != "dir-db-2" || conf.MySQL.MaxConn != 50 {
+		t.Fatalf("expect dir source change applied, got %+v", conf.MySQL)
+	}
+	if conf := current(); conf.Redis.ServerAddress != "dir-redis:6379" || Sources()[RedisDataId] != SourceDir {
+		t.Fatalf("expect redis created in dir source applied, got %+v %v", conf.Redis, Sources())
+	}
+}
+
+func TestEncryptedConfig(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	cipher, err := NewAESGCMCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(plaintext string) string {
+		ciphertext, err := cipher.Encrypt([]byte(plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return FormatEncrypted(ciphertext)
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+mysql:
+  host: localhost
+  user-name: root
+  password: `+encrypt("db-secret")+`
+  db-name: base
+`)
+	memory := NewMemorySource()
+	memory.Set(RedisDataId, DefaultGroup, "server-address: localhost:6379\npassword: "+encrypt("redis-secret"))
+	load := func() (*GlobalConfig, error) {
+		return Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")), WithSources(memory))
+	}
+
+	t.Setenv(EncryptKeyEnvKey, base64.StdEncoding.EncodeToString(key))
+	conf, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.MySQL.Password != "db-secret" || conf.Redis.Password != "redis-secret" {
+		t.Fatalf("expect passwords decrypted, got %q %q", conf.MySQL.Password, conf.Redis.Password)
+	}
+
+	t.Setenv(EncryptKeyEnvKey, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if _, err = load(); !errors.Is(err, ErrDecryptFailed) || !strings.Contains(err.Error(), "mysql.password") {
+		t.Fatalf("expect ErrDecryptFailed at mysql.password with wrong key, got %v", err)
+	}
+}
+
+// fakeConfigClient 模拟的Nacos配置客户端
+type fakeConfigClient struct {
+	mutex    sync.Mutex
+	down     bool
+	contents map[string]string
+	listened []string
+}
+
+func (f *fakeConfigClient) set(down bool, contents map[string]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.down, f.contents = down, contents
+}
+
+func (f *fakeConfigClient) GetConfig(param vo.ConfigParam) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.down {
+		return "", errors.New("connection refused")
+	}
+	return f.contents[param.Group+"/"+param.DataId], nil
+}
+
+func (f *fakeConfigClient) PublishConfig(vo.ConfigParam) (bool, error) { return true, nil }
+
+func (f *fakeConfigClient) DeleteConfig(vo.ConfigParam) (bool, error) { return true, nil }
+
+func (f *fakeConfigClient) ListenConfig(param vo.ConfigParam) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.listened = append(f.listened, param.Group+"/"+param.DataId)
+	return nil
+}
+
+func (f *fakeConfigClient) CancelListenConfig(vo.ConfigParam) error { return nil }
+
+func (f *fakeConfigClient) SearchConfig(vo.SearchConfigParam) (*model.ConfigPage, error) {
+	return &model.ConfigPage{}, nil
+}
+
+func (f *fakeConfigClient) CloseClient() {}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+nacos:
+  server-addr: 127.0.0.1:8848
+  snapshot-dir: `+filepath.Join(dir, "snapshot")+`
+  resync-interval: 1
+mysql:
+  user-name: root
+  db-name: base
+`)
+	fake := &fakeConfigClient{}
+	newNaCosClient = func(vo.NacosClientParam) (config_client.IConfigClient, error) { return fake, nil }
+	defer func() { newNaCosClient = clients.NewConfigClient }()
+	load := func() (*GlobalConfig, error) {
+		return Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	}
+
+	fake.set(false, map[string]string{DefaultGroup + "/" + MySqlDataId: "host: nacos-db"})
+	if conf, err := load(); err != nil || conf.MySQL.Host != "nacos-db" || Sources()[MySqlDataId] != SourceNaCos {
+		t.Fatalf("expect mysql loaded from nacos, got %v %v", err, Sources())
+	}
+
+	// Nacos不可用时从快照启动
+	fake.set(true, nil)
+	conf, err := load()
+	if err != nil || conf.MySQL.Host != "nacos-db" || Sources()[MySqlDataId] != SourceSnapshot {
+		t.Fatalf("expect mysql loaded from snapshot, got %v %v", err, Sources())
+	}
+
+	// Nacos恢复后配置无效时继续使用快照,之后重试
+	fake.set(false, map[string]string{DefaultGroup + "/" + MySqlDataId: "host: ["})
+	time.Sleep(2500 * time.Millisecond)
+	if Sources()[MySqlDataId] != SourceSnapshot || GlobalConf.MySQL.Host != "nacos-db" {
+		t.Fatalf("expect mysql kept from snapshot with invalid config, got %v %+v", Sources(), GlobalConf.MySQL)
+	}
+
+	// Nacos恢复后重新同步
+	fake.set(false, map[string]string{DefaultGroup + "/" + MySqlDataId: "host: nacos-db-2"})
+	deadline := time.Now().Add(5 * time.Second)
+	for Sources()[MySqlDataId] != SourceNaCos && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if Sources()[MySqlDataId] != SourceNaCos || GlobalConf.MySQL.Host != "nacos-db-2" {
+		t.Fatalf("expect mysql re-synced from nacos, got %v %+v", Sources(), GlobalConf.MySQL)
+	}
+
+	// 快照被篡改时拒绝使用
+	fake.set(true, nil)
+	snapshotPath := filepath.Join(dir, "snapshot", "public", DefaultGroup, MySqlDataId+".json")
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, snapshotPath, strings.Replace(string(data), "nacos-db-2", "evil-db", 1))
+	if _, err = load(); !errors.Is(err, ErrSourceUnreachable) {
+		t.Fatalf("expect ErrSourceUnreachable with corrupted snapshot, got %v", err)
+	}
+}
+
+func TestNaCosGroups(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+nacos:
+  server-addr: 127.0.0.1:8848
+  snapshot-dir: `+filepath.Join(dir, "snapshot")+`
+  group: SERVICE
+  data-ids:
+    mysql:
+      group: DB
+      namespace: db
+    custom:
+      group: CUSTOM
+  shared-data-ids:
+    - data-id: redis
+      group: SHARED
+      namespace: common
+`)
+	fakes := map[string]*fakeConfigClient{
+		"":       {contents: map[string]string{"SERVICE/redis": "db: 2", "CUSTOM/custom": "name: custom"}},
+		"common": {contents: map[string]string{"SHARED/redis": "server-address: shared:6379\ndb: 1"}},
+		"db":     {contents: map[string]string{"DB/mysql": "host: db-host\nuser-name: root\ndb-name: base"}},
+	}
+	newNaCosClient = func(param vo.NacosClientParam) (config_client.IConfigClient, error) {
+		return fakes[param.ClientConfig.NamespaceId], nil
+	}
+	defer func() { newNaCosClient = clients.NewConfigClient }()
+	custom := &struct {
+		Name string `yaml:"name"`
+	}{}
+	conf, err := Load(
+		context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")), WithCustomerConfigs("custom", custom),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 服务自身的配置覆盖共享配置
+	if conf.Redis.ServerAddress != "shared:6379" || conf.Redis.DB != 2 {
+		t.Fatalf("expect shared redis overridden by service redis, got %+v", conf.Redis)
+	}
+	if conf.MySQL.Host != "db-host" || custom.Name != "custom" {
+		t.Fatalf("expect mysql and custom loaded from their own group, got %+v %+v", conf.MySQL, custom)
+	}
+
+	// 监听使用data id绑定的命名空间与分组
+	for _, fake := range fakes {
+		fake.listened = nil
+	}
+	if err = RegisterConfigChangeHandler(MySqlDataId, "", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fakes["db"].listened, []string{"DB/mysql"}) || len(fakes[""].listened) != 0 {
+		t.Fatalf("expect mysql listened in namespace db, got %v %v", fakes["db"].listened, fakes[""].listened)
+	}
+}
+
+func TestDataSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+mysql:
+  host: localhost
+  user-name: root
+  db-name: base
+datasources:
+  order:
+    host: order-db
+    user-name: root
+    db-name: order
+    replicas:
+      - host: order-replica
+`)
+	conf, err := Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个数据源未配置的key使用mysql的内置默认配置
+	order := conf.DataSources["order"]
+	if order == nil || order.Port != 3306 || order.MaxConn != 20 || len(order.Replicas) != 1 {
+		t.Fatalf("expect order datasource merged with defaults, got %+v", order)
+	}
+
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+mysql:
+  host: localhost
+  user-name: root
+  db-name: base
+datasources:
+  default:
+    host: other-db
+    user-name: root
+    db-name: other
+  order:
+    host: order-db
+    db-name: order
+`)
+	_, err = Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 {
+		t.Fatalf("expect default conflict and missing user-name, got %v", err)
+	}
+}
+
+func TestRedisInstances(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+redis:
+  server-address: localhost:6379
+redis-instances:
+  cache:
+    mode: cluster
+    addresses: [cache-1:6379, cache-2:6379]
+`)
+	conf, err := Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个实例未配置的key使用redis的内置默认配置
+	cache := conf.RedisInstances["cache"]
+	if cache == nil || cache.PoolSize != 10 || len(cache.Addresses) != 2 || !IsConfigured(RedisInstancesDataId) {
+		t.Fatalf("expect cache instance merged with defaults, got %+v", cache)
+	}
+
+	writeFile(t, filepath.Join(dir, "config.yml"), `
+redis:
+  server-address: localhost:6379
+redis-instances:
+  default:
+    server-address: other:6379
+  session:
+    mode: sentinel
+    addresses: [sentinel:26379]
+`)
+	_, err = Load(context.Background(), WithConfigPath(filepath.Join(dir, "config.yml")))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 {
+		t.Fatalf("expect default conflict and missing master-name, got %v", err)
+	}
 }
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EncryptKeyEnvKey 配置解密密钥的环境变量,值为base64编码的16、24或32字节AES密钥
+	EncryptKeyEnvKey = "APP_CONFIG_KEY"
+	// EncryptKeyFileEnvKey 配置解密密钥文件路径的环境变量,文件内容为base64编码的密钥
+	EncryptKeyFileEnvKey = "APP_CONFIG_KEY_FILE"
+
+	encryptedPrefix = "ENC("
+	encryptedSuffix = ")"
+)
+
+// ErrDecryptFailed 配置中 ENC(...) 加密值解密失败
+var ErrDecryptFailed = errors.New("decrypt config value failed")
+
+// Decryptor 配置值解密器,ciphertext为 ENC(...) 中base64解码后的密文
+type Decryptor interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+var (
+	decryptorMutex sync.Mutex
+	// decryptor 当前使用的解密器,通过WithDecryptor指定,未指定时按环境变量中的密钥创建AES-GCM解密器
+	decryptor Decryptor
+)
+
+// setDecryptor 设置加载配置时使用的解密器,为空时使用环境变量中的密钥
+func setDecryptor(d Decryptor) {
+	decryptorMutex.Lock()
+	defer decryptorMutex.Unlock()
+	decryptor = d
+}
+
+// currentDecryptor 返回当前使用的解密器,未配置密钥时返回nil
+func currentDecryptor() (Decryptor, error) {
+	decryptorMutex.Lock()
+	defer decryptorMutex.Unlock()
+	if decryptor != nil {
+		return decryptor, nil
+	}
+	key, err := LoadEncryptKey()
+	if err != nil || key == nil {
+		return nil, err
+	}
+	return NewAESGCMCipher(key)
+}
+
+// LoadEncryptKey 读取环境变量 APP_CONFIG_KEY 或 APP_CONFIG_KEY_FILE 指定文件中的密钥,均未配置时返回nil
+func LoadEncryptKey() ([]byte, error) {
+	encoded, ok := os.LookupEnv(EncryptKeyEnvKey)
+	if !ok {
+		path, ok := os.LookupEnv(EncryptKeyFileEnvKey)
+		if !ok {
+			return nil, nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config key file errs: %w", err)
+		}
+		encoded = string(data)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("config key is not valid base64: %w", err)
+	}
+	return key, nil
+}
+
+// AESGCMCipher AES-GCM加解密,密文格式为 nonce + 密文 + 认证标签
+type AESGCMCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMCipher 创建AES-GCM加解密器,key长度为16、24或32字节
+func NewAESGCMCipher(key []byte) (*AESGCMCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCMCipher{aead: aead}, nil
+}
+
+// Encrypt 加密,每次使用随机nonce
+func (c *AESGCMCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt 解密并校验认证标签
+func (c *AESGCMCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	return c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+}
+
+// FormatEncrypted 将密文格式化为配置中使用的 ENC(base64) 形式
+func FormatEncrypted(ciphertext []byte) string {
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(ciphertext) + encryptedSuffix
+}
+
+// parseEncrypted 解析 ENC(base64) 形式的配置值,不是加密值时返回false
+func parseEncrypted(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, encryptedPrefix) || !strings.HasSuffix(value, encryptedSuffix) {
+		return "", false
+	}
+	return value[len(encryptedPrefix) : len(value)-len(encryptedSuffix)], true
+}
+
+// decryptTree 解密配置树中所有 ENC(...) 形式的值,错误信息中只包含配置路径,不包含密文与明文
+func decryptTree(tree map[string]interface{}, prefix []string) error {
+	var d Decryptor
+	var walk func(value interface{}, path []string) (interface{}, error)
+	walk = func(value interface{}, path []string) (interface{}, error) {
+		var text string
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				decrypted, err := walk(item, append(append([]string{}, path...), key))
+				if err != nil {
+					return nil, err
+				}
+				v[key] = decrypted
+			}
+			return v, nil
+		case []interface{}:
+			for i, item := range v {
+				decrypted, err := walk(item, append(append([]string{}, path...), fmt.Sprint(i)))
+				if err != nil {
+					return nil, err
+				}
+				v[i] = decrypted
+			}
+			return v, nil
+		case string:
+			text = v
+		case *yaml.Node:
+			text = v.Value
+		default:
+			return value, nil
+		}
+		encoded, ok := parseEncrypted(text)
+		if !ok {
+			return value, nil
+		}
+		key := strings.Join(path, ".")
+		if d == nil {
+			var err error
+			if d, err = currentDecryptor(); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrDecryptFailed, key, err)
+			}
+			if d == nil {
+				return nil, fmt.Errorf(
+					"%w: %s: no decryptor, set %s or %s", ErrDecryptFailed, key, EncryptKeyEnvKey, EncryptKeyFileEnvKey,
+				)
+			}
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: invalid base64", ErrDecryptFailed, key)
+		}
+		plaintext, err := d.Decrypt(ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrDecryptFailed, key, err)
+		}
+		return rawScalar(string(plaintext)), nil
+	}
+	_, err := walk(tree, prefix)
+	return err
+}
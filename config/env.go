@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvOverridePrefix 环境变量覆盖配置的前缀,如 APP_MYSQL_HOST 覆盖 mysql.host
+const EnvOverridePrefix = "APP_"
+
+// placeholderRegex 匹配 ${ENV_NAME} 与 ${ENV_NAME:default} 占位符
+var placeholderRegex = regexp.MustCompile(`\$\{([A-Za-z0-9_.\-]+)(?::([^}]*))?}`)
+
+// reservedEnvKeys 框架自身使用的环境变量,不作为配置覆盖
+var reservedEnvKeys = map[string]bool{
+	"APP_NAME":           true,
+	ProfileEnvKey:        true,
+	EncryptKeyEnvKey:     true,
+	EncryptKeyFileEnvKey: true,
+}
+
+// ResolvePlaceholders 解析字符串中的 ${ENV_NAME:default} 占位符,
+// 环境变量不存在时使用默认值,既无环境变量也无默认值时保留原样
+func ResolvePlaceholders(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return placeholderRegex.ReplaceAllStringFunc(
+		s, func(match string) string {
+			groups := placeholderRegex.FindStringSubmatch(match)
+			if value, ok := os.LookupEnv(groups[1]); ok {
+				return value
+			}
+			if strings.Contains(match, ":") {
+				return groups[2]
+			}
+			return match
+		},
+	)
+}
+
+// UnmarshalSection 解析某个配置段的yaml内容(如Nacos中data id为mysql的内容),
+// 先解析占位符并应用 APP_ 前缀的环境变量覆盖,再解密 ENC(...) 加密值,section为该段在config.yml中的key,为空表示顶层
+func UnmarshalSection(content string, section string, out interface{}) error {
+	return unmarshalSection(section, content, section, out)
+}
+
+// unmarshalSection 同UnmarshalSection,source为配置来源,用于错误信息
+func unmarshalSection(source, content, section string, out interface{}) error {
+	outType := reflect.TypeOf(out)
+	tree, err := parseYaml(source, []byte(content), outType)
+	if err != nil {
+		return err
+	}
+	var prefix []string
+	if section != "" {
+		prefix = []string{section}
+	}
+	overridden, err := resolveTree(tree, prefix, outType)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(data, out); err != nil {
+		return &ParseError{Source: overrideSource(source, overridden), Err: err}
+	}
+	return nil
+}
+
+// resolveTree 解析配置树中的占位符,应用环境变量覆盖后解密 ENC(...) 加密值
+// prefix为配置树在完整配置中的路径,hints为配置树对应的结构体类型,用于发现配置文件中未出现的key,
+// 返回是否解析了占位符或应用了环境变量覆盖
+func resolveTree(tree map[string]interface{}, prefix []string, hints ...reflect.Type) (bool, error) {
+	var overridden bool
+	resolveValue(tree, &overridden)
+	paths := make(map[string][]string)
+	collectTreePaths(tree, nil, paths)
+	for _, hint := range hints {
+		collectTypePaths(hint, nil, paths, 0)
+	}
+	for _, path := range paths {
+		envKey := envOverrideKey(append(append([]string{}, prefix...), path...))
+		if reservedEnvKeys[envKey] {
+			continue
+		}
+		if value, ok := os.LookupEnv(envKey); ok {
+			setTreeValue(tree, path, rawScalar(value))
+			overridden = true
+		}
+	}
+	return overridden, decryptTree(tree, prefix)
+}
+
+// overrideSource 解析失败时的配置来源,各来源已预先校验类型,解析了占位符或应用了环境变量覆盖时错误来自覆盖的值
+func overrideSource(source string, overridden bool) string {
+	if overridden {
+		return source + " (env override)"
+	}
+	return source
+}
+
+// resolveValue 递归解析配置值中的占位符,解析了占位符时将resolved置为true
+func resolveValue(value interface{}, resolved *bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = resolveValue(item, resolved)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = resolveValue(item, resolved)
+		}
+	case string:
+		if text := ResolvePlaceholders(v); text != v {
+			*resolved = true
+			return rawScalar(text)
+		}
+	}
+	return value
+}
+
+// rawScalar 将解析后的文本包装为无类型标量,由目标字段类型决定最终解析结果(如 port: ${DB_PORT:3306} 可解析为int)
+func rawScalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// envOverrideKey 生成配置路径对应的环境变量名,如 [mysql max-conn] → APP_MYSQL_MAX_CONN
+func envOverrideKey(path []string) string {
+	key := strings.ToUpper(strings.Join(path, "_"))
+	key = strings.NewReplacer("-", "_", ".", "_").Replace(key)
+	return EnvOverridePrefix + key
+}
+
+// collectTreePaths 收集配置树中所有叶子节点的路径
+func collectTreePaths(tree map[string]interface{}, path []string, paths map[string][]string) {
+	for key, value := range tree {
+		current := append(append([]string{}, path...), key)
+		if child, ok := value.(map[string]interface{}); ok {
+			collectTreePaths(child, current, paths)
+			continue
+		}
+		paths[strings.Join(current, ".")] = current
+	}
+}
+
+// collectTypePaths 根据结构体的yaml标签收集所有叶子字段的路径
+func collectTypePaths(t reflect.Type, path []string, paths map[string][]string, depth int) {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface) {
+		if t.Kind() == reflect.Interface {
+			return
+		}
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || depth > 8 {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			collectTypePaths(field.Type, path, paths, depth+1)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		current := append(append([]string{}, path...), name)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Struct {
+			collectTypePaths(fieldType, current, paths, depth+1)
+			continue
+		}
+		paths[strings.Join(current, ".")] = current
+	}
+}
+
+// setTreeValue 按路径设置配置树中的值,中间节点不存在时自动创建
+func setTreeValue(tree map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := tree[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			tree[key] = child
+		}
+		tree = child
+	}
+	tree[path[len(path)-1]] = value
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrConfigNotFound 本地配置文件不存在
+	ErrConfigNotFound = errors.New("config file not found")
+	// ErrSourceUnreachable 无法访问配置源或从配置源获取配置失败
+	ErrSourceUnreachable = errors.New("config source unreachable")
+	// ErrSourceDataEmpty 配置源中对应data id的配置不存在或为空
+	ErrSourceDataEmpty = errors.New("config source data empty")
+)
+
+// ParseError 配置内容解析错误,包含出错的来源与行列号(无法定位时为0)
+type ParseError struct {
+	Source string // 配置来源,本地文件路径或 {配置源}:{dataId},如 nacos:mysql
+	Line   int
+	Column int
+	Err    error
+}
+
+// Error 实现 error 接口
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("parse config [%s] at line %d, column %d: %v", e.Source, e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("parse config [%s]: %v", e.Source, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var errorLineRegex = regexp.MustCompile(`line (\d+)`)
+
+// newParseError 将yaml错误转换为ParseError,root不为空时根据行号定位出错节点的列号
+func newParseError(source string, root *yaml.Node, err error) *ParseError {
+	parseErr := &ParseError{Source: source, Err: err}
+	message := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		message = typeErr.Errors[0]
+	}
+	if groups := errorLineRegex.FindStringSubmatch(message); groups != nil {
+		parseErr.Line, _ = strconv.Atoi(groups[1])
+		parseErr.Column = findColumn(root, parseErr.Line)
+	}
+	return parseErr
+}
+
+// findColumn 查找指定行上的值节点所在列,优先返回映射中的值节点
+func findColumn(node *yaml.Node, line int) int {
+	if node == nil {
+		return 0
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if value := node.Content[i+1]; value.Line == line && value.Kind == yaml.ScalarNode {
+				return value.Column
+			}
+		}
+	}
+	for _, child := range node.Content {
+		if column := findColumn(child, line); column > 0 {
+			return column
+		}
+	}
+	if node.Line == line {
+		return node.Column
+	}
+	return 0
+}
+
+// parseYaml 解析yaml内容为配置树,并按hints中的结构体类型预先校验字段类型,
+// 出错时返回带行列号的ParseError
+func parseYaml(source string, content []byte, hints ...reflect.Type) (map[string]interface{}, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, newParseError(source, nil, err)
+	}
+	tree := make(map[string]interface{})
+	if root.Kind == 0 {
+		return tree, nil
+	}
+	if err := root.Decode(&tree); err != nil {
+		return nil, newParseError(source, &root, err)
+	}
+	// 在保留行列号的节点上解析占位符后按目标类型试解析
+	resolveNodePlaceholders(&root)
+	for _, hint := range hints {
+		for hint.Kind() == reflect.Ptr {
+			hint = hint.Elem()
+		}
+		if err := root.Decode(reflect.New(hint).Interface()); err != nil {
+			return nil, newParseError(source, &root, err)
+		}
+	}
+	return tree, nil
+}
+
+// resolveNodePlaceholders 解析节点中的占位符,解析后的标量不再携带字符串标签,由目标字段类型决定如何解析
+func resolveNodePlaceholders(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		if resolved := ResolvePlaceholders(node.Value); resolved != node.Value {
+			node.Value = resolved
+			node.Tag = ""
+			node.Style = 0
+		}
+		return
+	}
+	for _, child := range node.Content {
+		resolveNodePlaceholders(child)
+	}
+}
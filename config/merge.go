@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// ProfileEnvKey 指定激活环境的环境变量,多个环境用逗号分隔,如 APP_PROFILE=dev,local
+const ProfileEnvKey = "APP_PROFILE"
+
+// resolveProfiles 获取激活的环境列表,BootOption优先,其次为环境变量
+func resolveProfiles(bootConfig *BootstrapConfig) []string {
+	profile := ""
+	if bootConfig != nil {
+		profile = bootConfig.Profile
+	}
+	if profile == "" {
+		profile = os.Getenv(ProfileEnvKey)
+	}
+	var profiles []string
+	for _, p := range strings.Split(profile, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles
+}
+
+// profileConfigPath 根据基础配置路径生成环境配置路径,如 ./config/config.yml → ./config/config-dev.yml
+func profileConfigPath(basePath, profile string) string {
+	ext := filepath.Ext(basePath)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(basePath, ext), profile, ext)
+}
+
+// readLayeredConfig 读取基础配置并按顺序叠加各环境配置,返回合并后的配置树
+// hints为配置对应的结构体类型,用于在合并前定位每个文件中的类型错误
+func readLayeredConfig(basePath string, profiles []string, hints ...reflect.Type) (map[string]interface{}, error) {
+	fileByte, err := os.ReadFile(basePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, basePath)
+		}
+		return nil, fmt.Errorf("read config file path:[%s],errs,%w", basePath, err)
+	}
+	tree, err := parseYaml(basePath, fileByte, hints...)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		profilePath := profileConfigPath(basePath, profile)
+		profileByte, err := os.ReadFile(profilePath)
+		if err != nil {
+			// 环境配置文件不存在时仅使用基础配置
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("read profile config file path:[%s],errs,%w", profilePath, err)
+		}
+		overlay, err := parseYaml(profilePath, profileByte, hints...)
+		if err != nil {
+			return nil, err
+		}
+		tree = mergeTree(tree, overlay)
+	}
+	return tree, nil
+}
+
+// mergeTree 按key深度合并配置,overlay中的值覆盖base中的同名key,map递归合并,列表与标量整体替换
+func mergeTree(base, overlay map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		base = make(map[string]interface{}, len(overlay))
+	}
+	for key, value := range overlay {
+		overlayMap, ok := value.(map[string]interface{})
+		if !ok {
+			base[key] = value
+			continue
+		}
+		baseMap, ok := base[key].(map[string]interface{})
+		if !ok {
+			base[key] = overlayMap
+			continue
+		}
+		base[key] = mergeTree(baseMap, overlayMap)
+	}
+	return base
+}
@@ -0,0 +1,401 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceKind 配置段生效值的来源,优先级 配置源 > 本地配置文件 > 内置默认配置,
+// 来自配置源时为配置源的名称
+type SourceKind string
+
+const (
+	SourceDefault  SourceKind = "default"  // 内置默认配置
+	SourceLocal    SourceKind = "local"    // 本地配置文件(含环境配置与环境变量覆盖)
+	SourceNaCos    SourceKind = "nacos"    // Nacos配置中心
+	SourceDir      SourceKind = "dir"      // 本地目录配置源
+	SourceMemory   SourceKind = "memory"   // 内存配置源
+	SourceSnapshot SourceKind = "snapshot" // 配置源不可用时使用的本地快照,处于降级模式
+)
+
+// sectionSources 各配置段生效值的来源,key为data id
+var sectionSources = make(map[string]SourceKind)
+
+// Sources 返回各配置段(key为data id)生效值的来源,未配置的配置段不包含在内
+func Sources() map[string]SourceKind {
+	changeMutex.Lock()
+	defer changeMutex.Unlock()
+	sources := make(map[string]SourceKind, len(sectionSources))
+	for dataId, source := range sectionSources {
+		sources[dataId] = source
+	}
+	return sources
+}
+
+// IsConfigured 配置段是否由本地配置文件或配置源显式配置,仅有内置默认配置时返回false
+func IsConfigured(dataId string) bool {
+	source, ok := Sources()[dataId]
+	return ok && source != SourceDefault
+}
+
+// 内置默认配置
+var (
+	defaultLoggerParam = &LoggerConfig{
+		Filename:   "./base.log",
+		MaxSize:    50,
+		MaxBackups: 30,
+		MaxAge:     30,
+		Compress:   true,
+		Level:      "INFO",
+	}
+	defaultMySqlParam = &MySqlConfig{
+		Port:        3306,
+		MaxIdle:     10,
+		MaxConn:     20,
+		MaxLife:     120,
+		MaxIdleTime: 30,
+
+		CreateTimeColumn: "create_time",
+		UpdateTimeColumn: "update_time",
+		CreateByColumn:   "create_by",
+		UpdateByColumn:   "update_by",
+
+		SlowThreshold: 3000,
+		LogLevel:      "INFO",
+
+		SqlLogMode:       "full",
+		SqlLogSampleRate: 100,
+	}
+	defaultRedisParam = &RedisConfig{
+		PoolSize:     10,
+		MinIdleCones: 5,
+	}
+)
+
+// section 可从配置源加载并热更新的配置段
+type section struct {
+	dataId   string
+	key      string                                  // 在config.yml中的key,定制配置为空表示整个配置文件
+	defaults interface{}                             // 内置默认配置,为空表示无默认配置
+	entry    interface{}                             // map类型配置段中每一项的内置默认配置,如各数据源
+	tolerant bool                                    // 配置源不可用且无快照时是否降级使用本地或默认配置
+	newValue func() interface{}                      // 创建该配置段的空结构体指针
+	current  func(conf *GlobalConfig) interface{}    // 获取当前生效的配置
+	apply    func(conf *GlobalConfig, v interface{}) // 使新配置生效
+	base     map[string]interface{}                  // 默认配置与本地配置合并后的配置树,配置源的配置在此基础上覆盖
+	baseKind SourceKind                              // 默认配置与本地配置合并后的来源
+	remotes  []*remote                               // 该配置段在各配置源中的配置项,靠后的优先级高
+}
+
+// remote 配置段在某个配置源中的一个配置项的内容
+type remote struct {
+	sourceItem
+	content  string // 当前生效的原始内容,降级时为快照内容
+	fetched  bool   // 启动时是否成功访问配置源(内容可能为空),成功时保存快照
+	degraded bool   // 是否因配置源不可用而使用快照启动
+}
+
+// newBuiltinSections 创建内置的配置段
+func newBuiltinSections() []*section {
+	return []*section{
+		{
+			dataId:   LoggerDataId,
+			key:      "logger",
+			defaults: defaultLoggerParam,
+			tolerant: true,
+			newValue: func() interface{} { return new(LoggerConfig) },
+			current:  func(conf *GlobalConfig) interface{} { return conf.Logger },
+			apply:    func(conf *GlobalConfig, v interface{}) { conf.Logger = v.(*LoggerConfig) },
+		},
+		{
+			dataId:   MySqlDataId,
+			key:      "mysql",
+			defaults: defaultMySqlParam,
+			newValue: func() interface{} { return new(MySqlConfig) },
+			current:  func(conf *GlobalConfig) interface{} { return conf.MySQL },
+			apply:    func(conf *GlobalConfig, v interface{}) { conf.MySQL = v.(*MySqlConfig) },
+		},
+		{
+			dataId:   RedisDataId,
+			key:      "redis",
+			defaults: defaultRedisParam,
+			newValue: func() interface{} { return new(RedisConfig) },
+			current:  func(conf *GlobalConfig) interface{} { return conf.Redis },
+			apply:    func(conf *GlobalConfig, v interface{}) { conf.Redis = v.(*RedisConfig) },
+		},
+		{
+			dataId:   DataSourcesDataId,
+			key:      "datasources",
+			entry:    defaultMySqlParam,
+			newValue: func() interface{} { return new(DataSourcesConfig) },
+			current: func(conf *GlobalConfig) interface{} {
+				if conf.DataSources == nil {
+					return nil
+				}
+				// 复制map引用,新配置生效时替换为新的map
+				dataSources := conf.DataSources
+				return &dataSources
+			},
+			apply: func(conf *GlobalConfig, v interface{}) { conf.DataSources = *v.(*DataSourcesConfig) },
+		},
+		{
+			dataId:   RedisInstancesDataId,
+			key:      "redis-instances",
+			entry:    defaultRedisParam,
+			newValue: func() interface{} { return new(RedisInstancesConfig) },
+			current: func(conf *GlobalConfig) interface{} {
+				if conf.RedisInstances == nil {
+					return nil
+				}
+				redisInstances := conf.RedisInstances
+				return &redisInstances
+			},
+			apply: func(conf *GlobalConfig, v interface{}) { conf.RedisInstances = *v.(*RedisInstancesConfig) },
+		},
+		{
+			dataId:   WebDataId,
+			key:      "web-server",
+			newValue: func() interface{} { return new(WebServerConfig) },
+			current:  func(conf *GlobalConfig) interface{} { return conf.WebServer },
+			apply:    func(conf *GlobalConfig, v interface{}) { conf.WebServer = v.(*WebServerConfig) },
+		},
+	}
+}
+
+// newCustomSection 定制配置段,生效时将新配置复制到注册时传入的结构体指针中
+func newCustomSection(name string, target interface{}) *section {
+	targetType := reflect.TypeOf(target).Elem()
+	return &section{
+		dataId:   name,
+		newValue: func() interface{} { return reflect.New(targetType).Interface() },
+		current: func(*GlobalConfig) interface{} {
+			// 复制一份当前配置,避免被新配置覆盖
+			snapshot := reflect.New(targetType)
+			snapshot.Elem().Set(reflect.ValueOf(target).Elem())
+			return snapshot.Interface()
+		},
+		apply: func(_ *GlobalConfig, v interface{}) {
+			reflect.ValueOf(target).Elem().Set(reflect.ValueOf(v).Elem())
+		},
+	}
+}
+
+// newSections 创建内置配置段及所有定制配置段,各配置段从sources中加载
+func newSections(bootConfig *BootstrapConfig, sources []Source) ([]*section, error) {
+	sections := newBuiltinSections()
+	for name, customConfig := range bootConfig.CustomerConfigs {
+		if reflect.TypeOf(customConfig).Kind() != reflect.Ptr {
+			continue
+		}
+		sections = append(sections, newCustomSection(name, customConfig))
+	}
+	for _, s := range sections {
+		for _, source := range sources {
+			items, err := sourceItems(source, s.dataId)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				s.remotes = append(s.remotes, &remote{sourceItem: item})
+			}
+		}
+	}
+	return sections, nil
+}
+
+// load 按 默认配置 < 本地配置 < 各配置源 的优先级逐key合并出该配置段的生效值,
+// 未配置且无默认配置时返回nil
+func (s *section) load(localTree map[string]interface{}) (interface{}, SourceKind, error) {
+	s.base, s.baseKind = make(map[string]interface{}), ""
+	if s.defaults != nil {
+		defaults, err := toTree(s.defaults)
+		if err != nil {
+			return nil, "", err
+		}
+		s.base, s.baseKind = defaults, SourceDefault
+	}
+	local := localTree
+	if s.key != "" {
+		local, _ = localTree[s.key].(map[string]interface{})
+	}
+	if local != nil {
+		s.base, s.baseKind = mergeTree(s.base, copyTree(local)), SourceLocal
+	}
+	blank := len(s.remotes) > 0
+	for _, r := range s.remotes {
+		if err := s.fetch(r); err != nil {
+			return nil, "", err
+		}
+		blank = blank && r.fetched && r.content == ""
+	}
+	// 定制配置以整个配置文件为key,所有配置源中均为空时视为配置缺失
+	if blank && s.key == "" {
+		return nil, "", fmt.Errorf("%w: data id[%s]", ErrSourceDataEmpty, s.dataId)
+	}
+	kind := s.kind()
+	if kind == "" {
+		return nil, "", nil
+	}
+	tree, err := s.merge(nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	value, err := s.decode(tree)
+	return value, kind, err
+}
+
+// fetch 从配置源获取该配置段的内容,配置源不可用时使用快照
+func (s *section) fetch(r *remote) error {
+	content, err := r.source.Get(r.dataId, r.group)
+	r.fetched = err == nil || errors.Is(err, ErrSourceDataEmpty)
+	switch {
+	case err == nil:
+		r.content = content
+	case errors.Is(err, ErrSourceDataEmpty):
+		if s.key != "" {
+			logrus.Warnf("Fetch config from %s with data id[%s] group[%s] is blank", r.source.Name(), r.dataId, r.group)
+		}
+	case errors.Is(err, ErrSourceUnreachable):
+		snap, snapshotErr := loadSnapshot(r.source, r.dataId, r.group)
+		if snapshotErr == nil {
+			// 快照为空表示配置源中原本就没有该配置
+			logrus.Warnf("%v,start from snapshot saved at %v in degraded mode", err, snap.SavedAt)
+			r.content, r.degraded = snap.Content, true
+			return nil
+		}
+		if !s.tolerant {
+			return fmt.Errorf("%w,and no available snapshot: %v", err, snapshotErr)
+		}
+		logrus.Warnf("%v,ignore config source %s", err, r.source.Name())
+	default:
+		return err
+	}
+	return nil
+}
+
+// kind 该配置段生效值的来源,为最后一个有内容的配置源,均无内容时为本地或默认配置
+func (s *section) kind() SourceKind {
+	kind := s.baseKind
+	for _, r := range s.remotes {
+		switch {
+		case r.content == "":
+		case r.degraded:
+			kind = SourceSnapshot
+		default:
+			kind = SourceKind(r.source.Name())
+		}
+	}
+	return kind
+}
+
+// merge 将各配置源的内容依次覆盖在默认配置与本地配置之上,changed不为空时使用data代替其内容
+func (s *section) merge(changed *remote, data string) (map[string]interface{}, error) {
+	tree := copyTree(s.base)
+	for _, r := range s.remotes {
+		content := r.content
+		if r == changed {
+			content = data
+		}
+		if content == "" {
+			continue
+		}
+		remoteTree, err := s.parse(r.source, content)
+		if err != nil {
+			return nil, err
+		}
+		tree = mergeTree(tree, remoteTree)
+	}
+	if s.entry != nil {
+		entry, err := toTree(s.entry)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range tree {
+			if item, ok := value.(map[string]interface{}); ok {
+				tree[key] = mergeTree(copyTree(entry), item)
+			}
+		}
+	}
+	return tree, nil
+}
+
+// saveSnapshots 保存启动时成功从配置源获取的内容的快照
+func (s *section) saveSnapshots() {
+	for _, r := range s.remotes {
+		if r.fetched {
+			saveSnapshot(r.source, r.dataId, r.group, r.content)
+		}
+	}
+}
+
+// parse 解析配置源中该配置段的内容为配置树
+func (s *section) parse(source Source, content string) (map[string]interface{}, error) {
+	valueType := reflect.TypeOf(s.newValue())
+	tree, err := parseYaml(source.Name()+":"+s.dataId, []byte(content), valueType)
+	if err != nil {
+		return nil, err
+	}
+	var prefix []string
+	if s.key != "" {
+		prefix = []string{s.key}
+	}
+	if _, err = resolveTree(tree, prefix, valueType); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// decode 将配置树解析为该配置段的结构体
+func (s *section) decode(tree map[string]interface{}) (interface{}, error) {
+	data, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	value := s.newValue()
+	if err = yaml.Unmarshal(data, value); err != nil {
+		return nil, &ParseError{Source: s.dataId, Err: err}
+	}
+	return value, nil
+}
+
+// toTree 将配置结构体转换为配置树
+func toTree(value interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]interface{})
+	err = yaml.Unmarshal(data, &tree)
+	return tree, err
+}
+
+// copyTree 深拷贝配置树,避免合并时修改原配置树
+func copyTree(tree map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(tree))
+	for key, value := range tree {
+		if child, ok := value.(map[string]interface{}); ok {
+			value = copyTree(child)
+		}
+		copied[key] = value
+	}
+	return copied
+}
+
+// withoutDefaultSections 返回去掉仅有默认配置的配置段后的配置,用于校验
+func withoutDefaultSections(conf *GlobalConfig, sources map[string]SourceKind) *GlobalConfig {
+	checked := *conf
+	if sources[LoggerDataId] == SourceDefault {
+		checked.Logger = nil
+	}
+	if sources[MySqlDataId] == SourceDefault {
+		checked.MySQL = nil
+	}
+	if sources[RedisDataId] == SourceDefault {
+		checked.Redis = nil
+	}
+	return &checked
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultSnapshotDir 默认的Nacos配置快照目录
+	defaultSnapshotDir = "./config/snapshot"
+	// defaultResyncInterval 降级模式下重新同步配置源的默认间隔,单位为秒
+	defaultResyncInterval = 10
+)
+
+// ErrSnapshotCorrupted 快照内容与校验和不一致
+var ErrSnapshotCorrupted = errors.New("nacos config snapshot corrupted")
+
+// snapshot 某个data id最近一次有效配置的快照
+type snapshot struct {
+	DataId    string    `json:"dataId"`
+	Group     string    `json:"group"`
+	Namespace string    `json:"namespace"`
+	Content   string    `json:"content"`
+	SavedAt   time.Time `json:"savedAt"`
+	Checksum  string    `json:"checksum"` // 配置了snapshot-key时为HMAC-SHA256,否则为SHA256
+}
+
+// snapshotStore 本地磁盘上的Nacos配置快照,用于Nacos不可用时离线启动
+type snapshotStore struct {
+	dir       string
+	namespace string
+	key       []byte
+}
+
+// snapshotSource 不可用时可从本地快照启动的配置源,如Nacos
+type snapshotSource interface {
+	Source
+	snapshotStore() *snapshotStore
+}
+
+// newSnapshotStore 根据Nacos配置创建快照存储
+func newSnapshotStore(conf *NaCosConfig) *snapshotStore {
+	dir := conf.SnapshotDir
+	if dir == "" {
+		dir = defaultSnapshotDir
+	}
+	namespace := conf.Namespace
+	if namespace == "" {
+		namespace = "public"
+	}
+	return &snapshotStore{dir: dir, namespace: namespace, key: []byte(conf.SnapshotKey)}
+}
+
+func (s *snapshotStore) path(dataId, group string) string {
+	return filepath.Join(s.dir, s.namespace, group, dataId+".json")
+}
+
+func (s *snapshotStore) checksum(dataId, group, content string) string {
+	payload := []byte(s.namespace + "\n" + group + "\n" + dataId + "\n" + content)
+	if len(s.key) > 0 {
+		mac := hmac.New(sha256.New, s.key)
+		mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// save 保存配置快照,先写临时文件再重命名,避免进程中断时留下不完整的快照
+func (s *snapshotStore) save(dataId, group, content string) error {
+	path := s.path(dataId, group)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(
+		&snapshot{
+			DataId:    dataId,
+			Group:     group,
+			Namespace: s.namespace,
+			Content:   content,
+			SavedAt:   time.Now(),
+			Checksum:  s.checksum(dataId, group, content),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// load 读取并校验配置快照
+func (s *snapshotStore) load(dataId, group string) (*snapshot, error) {
+	data, err := os.ReadFile(s.path(dataId, group))
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshot
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupted, err)
+	}
+	expected := s.checksum(dataId, group, snap.Content)
+	if snap.DataId != dataId || snap.Group != group || !hmac.Equal([]byte(snap.Checksum), []byte(expected)) {
+		return nil, fmt.Errorf("%w: data id[%s]", ErrSnapshotCorrupted, dataId)
+	}
+	return &snap, nil
+}
+
+// saveSnapshot 保存配置源的配置快照,配置源不保存快照时忽略,失败时仅告警
+func saveSnapshot(source Source, dataId, group, content string) {
+	snapshots, ok := source.(snapshotSource)
+	if !ok {
+		return
+	}
+	if err := snapshots.snapshotStore().save(dataId, group, content); err != nil {
+		logrus.Warnf("Save snapshot of config data id[%s] errs: %v", dataId, err)
+	}
+}
+
+// loadSnapshot 读取配置源的配置快照,配置源不保存快照时返回os.ErrNotExist
+func loadSnapshot(source Source, dataId, group string) (*snapshot, error) {
+	snapshots, ok := source.(snapshotSource)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return snapshots.snapshotStore().load(dataId, group)
+}
+
+var (
+	resyncMutex  sync.Mutex
+	resyncCancel context.CancelFunc
+)
+
+// startResync 降级模式下定时重新从不可用的配置源获取配置,获取成功且配置有效时按配置变更处理,
+// 所有配置源都同步成功后退出降级
+func startResync(sections []*section, interval time.Duration) {
+	type degradedRemote struct {
+		section *section
+		remote  *remote
+	}
+	var degraded []degradedRemote
+	for _, s := range sections {
+		for _, r := range s.remotes {
+			if r.degraded {
+				degraded = append(degraded, degradedRemote{section: s, remote: r})
+			}
+		}
+	}
+	resyncMutex.Lock()
+	defer resyncMutex.Unlock()
+	if resyncCancel != nil {
+		resyncCancel()
+		resyncCancel = nil
+	}
+	if len(degraded) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	resyncCancel = cancel
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for len(degraded) > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			remaining := degraded[:0]
+			for _, d := range degraded {
+				content, err := d.remote.source.Get(d.remote.dataId, d.remote.group)
+				if err != nil && !errors.Is(err, ErrSourceDataEmpty) {
+					remaining = append(remaining, d)
+					continue
+				}
+				logrus.Infof(
+					"Config source %s is reachable again,re-sync config data id[%s]", d.remote.source.Name(), d.section.dataId,
+				)
+				// 恢复后的配置无效时仍使用快照,下次重新获取
+				if !onRemoteChange(d.section, d.remote, content, true) {
+					remaining = append(remaining, d)
+				}
+			}
+			degraded = remaining
+		}
+		logrus.Infof("All config re-synced,leave degraded mode")
+	}()
+}
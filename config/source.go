@@ -0,0 +1,176 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SourceTypeNaCos = "nacos" // Nacos配置源,使用nacos配置块连接Nacos
+	SourceTypeDir   = "dir"   // 本地目录配置源,轮询目录下的配置文件
+)
+
+// Source 配置源,按data id与group提供各配置段的内容
+type Source interface {
+	// Name 配置源名称,同时作为配置段生效值的来源,如 nacos、dir
+	Name() string
+	// Get 获取配置内容,配置源不可用时返回ErrSourceUnreachable,配置不存在或为空时返回ErrSourceDataEmpty
+	Get(dataId, group string) (string, error)
+	// Watch 监听配置变更,配置内容变化时回调onChange
+	Watch(dataId, group string, onChange ChangeHandler) error
+	// Close 停止监听并释放配置源占用的资源
+	Close() error
+}
+
+// SourceConfig 配置源配置,sources中靠后的配置源逐key覆盖靠前的配置源
+type SourceConfig struct {
+	Type         string `yaml:"type" validate:"required,oneof=nacos dir"` // 配置源类型
+	Path         string `yaml:"path" validate:"required_if=Type dir"`     // 本地目录配置源的目录
+	PollInterval int    `yaml:"poll-interval" validate:"min=0"`           // 本地目录配置源的轮询间隔,单位为秒,默认3秒
+}
+
+var (
+	sourceMutex sync.Mutex
+	// activeSources 当前生效的配置源,重新加载配置时关闭
+	activeSources []Source
+)
+
+// newSources 按sources配置创建配置源,未配置sources但配置了nacos时使用Nacos配置源,
+// 通过WithSources传入的配置源优先级最高
+func newSources(conf *GlobalConfig, bootConfig *BootstrapConfig) ([]Source, error) {
+	sourceConfigs := conf.Sources
+	if sourceConfigs == nil && conf.NaCos != nil {
+		sourceConfigs = []*SourceConfig{{Type: SourceTypeNaCos}}
+	}
+	var sources []Source
+	for _, sourceConfig := range sourceConfigs {
+		var source Source
+		switch sourceConfig.Type {
+		case SourceTypeNaCos:
+			if conf.NaCos == nil {
+				closeSources(sources)
+				return nil, errors.New("使用nacos配置源时需配置nacos")
+			}
+			naCos, err := NewNaCosSource(conf.NaCos)
+			if err != nil {
+				closeSources(sources)
+				return nil, fmt.Errorf("初始化Nacos客户端错误: %w", err)
+			}
+			NaCosClient = naCos.(*naCosSource).client
+			source = naCos
+		case SourceTypeDir:
+			interval := time.Duration(sourceConfig.PollInterval) * time.Second
+			source = NewDirSource(sourceConfig.Path, interval)
+		default:
+			closeSources(sources)
+			return nil, fmt.Errorf("不支持的配置源类型%s", sourceConfig.Type)
+		}
+		sources = append(sources, source)
+	}
+	return append(sources, bootConfig.Sources...), nil
+}
+
+// replaceSources 使用新加载的配置源,并关闭之前的配置源
+func replaceSources(sources []Source) {
+	sourceMutex.Lock()
+	defer sourceMutex.Unlock()
+	closeSources(activeSources)
+	activeSources = sources
+}
+
+// closeSources 关闭配置源,失败时仅告警
+func closeSources(sources []Source) {
+	for _, source := range sources {
+		if err := source.Close(); err != nil {
+			logrus.Warnf("Close config source %s errs: %v", source.Name(), err)
+		}
+	}
+}
+
+// sourceItem 配置段在配置源中对应的配置项
+type sourceItem struct {
+	source Source
+	dataId string
+	group  string
+}
+
+// itemResolver 一个配置段可对应多个配置项的配置源,如Nacos中的共享配置
+type itemResolver interface {
+	items(dataId string) ([]sourceItem, error)
+}
+
+// sourceItems 配置段在配置源中对应的配置项,按优先级从低到高排列,默认为默认分组中与配置段同名的data id
+func sourceItems(source Source, dataId string) ([]sourceItem, error) {
+	if resolver, ok := source.(itemResolver); ok {
+		return resolver.items(dataId)
+	}
+	return []sourceItem{{source: source, dataId: dataId, group: DefaultGroup}}, nil
+}
+
+// sourceKey 配置源中配置项的标识
+type sourceKey struct {
+	dataId string
+	group  string
+}
+
+// MemorySource 内存配置源,主要用于测试,通过Set修改配置并同步回调监听器
+type MemorySource struct {
+	mutex    sync.Mutex
+	contents map[sourceKey]string
+	handlers map[sourceKey][]ChangeHandler
+}
+
+// NewMemorySource 创建内存配置源
+func NewMemorySource() *MemorySource {
+	return &MemorySource{contents: make(map[sourceKey]string), handlers: make(map[sourceKey][]ChangeHandler)}
+}
+
+func (m *MemorySource) Name() string {
+	return string(SourceMemory)
+}
+
+func (m *MemorySource) Get(dataId, group string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	content := m.contents[sourceKey{dataId: dataId, group: group}]
+	if content == "" {
+		return "", fmt.Errorf("%w: memory data id[%s]", ErrSourceDataEmpty, dataId)
+	}
+	return content, nil
+}
+
+func (m *MemorySource) Watch(dataId, group string, onChange ChangeHandler) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := sourceKey{dataId: dataId, group: group}
+	m.handlers[key] = append(m.handlers[key], onChange)
+	return nil
+}
+
+// Close 移除所有监听器,配置内容保留
+func (m *MemorySource) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.handlers = make(map[sourceKey][]ChangeHandler)
+	return nil
+}
+
+// Set 设置配置内容,内容有变化时回调监听器
+func (m *MemorySource) Set(dataId, group, content string) {
+	m.mutex.Lock()
+	key := sourceKey{dataId: dataId, group: group}
+	if m.contents[key] == content {
+		m.mutex.Unlock()
+		return
+	}
+	m.contents[key] = content
+	handlers := append([]ChangeHandler{}, m.handlers[key]...)
+	m.mutex.Unlock()
+	for _, handler := range handlers {
+		handler(content)
+	}
+}
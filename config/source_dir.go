@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval 本地目录配置源默认的轮询间隔
+const defaultPollInterval = 3 * time.Second
+
+// dirWatch 本地目录配置源中被监听的配置文件
+type dirWatch struct {
+	content  string
+	handlers []ChangeHandler
+}
+
+// dirSource 本地目录配置源,默认分组的配置文件为 {dir}/{dataId}.yml,
+// 其他分组为 {dir}/{group}/{dataId}.yml,通过定时轮询文件内容发现变更
+type dirSource struct {
+	dir      string
+	interval time.Duration
+	mutex    sync.Mutex
+	watches  map[sourceKey]*dirWatch
+	cancel   context.CancelFunc
+}
+
+// NewDirSource 创建本地目录配置源,interval为轮询间隔,不大于0时为3秒
+func NewDirSource(dir string, interval time.Duration) Source {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	return &dirSource{dir: dir, interval: interval, watches: make(map[sourceKey]*dirWatch)}
+}
+
+func (d *dirSource) Name() string {
+	return string(SourceDir)
+}
+
+func (d *dirSource) Get(dataId, group string) (string, error) {
+	if _, err := os.Stat(d.dir); err != nil {
+		return "", fmt.Errorf("%w: config dir %s errs:%v", ErrSourceUnreachable, d.dir, err)
+	}
+	base := d.dir
+	if group != "" && group != DefaultGroup {
+		base = filepath.Join(d.dir, group)
+	}
+	for _, ext := range []string{".yml", ".yaml"} {
+		data, err := os.ReadFile(filepath.Join(base, dataId+ext))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: read config data id[%s] errs:%v", ErrSourceUnreachable, dataId, err)
+		}
+		if len(data) == 0 {
+			break
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("%w: dir %s data id[%s]", ErrSourceDataEmpty, d.dir, dataId)
+}
+
+// Watch 监听配置文件变更,首次监听时启动轮询
+func (d *dirSource) Watch(dataId, group string, onChange ChangeHandler) error {
+	content, err := d.Get(dataId, group)
+	if err != nil && !errors.Is(err, ErrSourceDataEmpty) {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	key := sourceKey{dataId: dataId, group: group}
+	watch, ok := d.watches[key]
+	if !ok {
+		watch = &dirWatch{content: content}
+		d.watches[key] = watch
+	}
+	watch.handlers = append(watch.handlers, onChange)
+	if d.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		d.cancel = cancel
+		go d.poll(ctx)
+	}
+	return nil
+}
+
+// Close 停止轮询并移除所有监听器
+func (d *dirSource) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	d.watches = make(map[sourceKey]*dirWatch)
+	return nil
+}
+
+// poll 定时读取被监听的配置文件,内容变化时回调监听器,目录暂时不可访问时跳过
+func (d *dirSource) poll(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d.mutex.Lock()
+		keys := make([]sourceKey, 0, len(d.watches))
+		for key := range d.watches {
+			keys = append(keys, key)
+		}
+		d.mutex.Unlock()
+		for _, key := range keys {
+			content, err := d.Get(key.dataId, key.group)
+			if err != nil && !errors.Is(err, ErrSourceDataEmpty) {
+				continue
+			}
+			d.mutex.Lock()
+			watch, ok := d.watches[key]
+			if !ok || ctx.Err() != nil || watch.content == content {
+				d.mutex.Unlock()
+				continue
+			}
+			watch.content = content
+			handlers := append([]ChangeHandler{}, watch.handlers...)
+			d.mutex.Unlock()
+			for _, handler := range handlers {
+				handler(content)
+			}
+		}
+	}
+}
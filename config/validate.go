@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/SUPERDBFMP/go-base/util"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError 单个配置字段的校验错误
+type FieldError struct {
+	Section string // 配置段,如 global 或定制配置名称
+	Field   string // 字段的yaml路径,如 mysql.port
+	Rule    string // 未通过的校验规则,如 required
+	Param   string // 校验规则参数,如 min=1 中的 1
+}
+
+func (e FieldError) String() string {
+	if e.Param != "" {
+		return fmt.Sprintf("[%s] %s: %s=%s", e.Section, e.Field, e.Rule, e.Param)
+	}
+	return fmt.Sprintf("[%s] %s: %s", e.Section, e.Field, e.Rule)
+}
+
+// ValidationError 配置校验错误,汇总所有不合法的字段
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error 实现 error 接口,输出所有不合法字段的汇总报告
+func (e *ValidationError) Error() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("config validation failed, %d invalid field(s):", len(e.Fields)))
+	for _, field := range e.Fields {
+		builder.WriteString("\n  ")
+		builder.WriteString(field.String())
+	}
+	return builder.String()
+}
+
+// GlobalSection 全局配置在校验报告中的名称
+const GlobalSection = "global"
+
+// yamlTagName 校验错误中的字段名使用yaml标签名
+func yamlTagName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// newConfigValidator 创建配置校验器,错误中的字段名使用yaml标签名
+func newConfigValidator(validatorMap map[string]validator.Func) (*validator.Validate, error) {
+	return util.NewValidator(validatorMap, yamlTagName)
+}
+
+// Validate 按validate标签校验全局配置与定制配置,返回汇总所有不合法字段的ValidationError
+// validatorMap为额外的自定义校验规则,与web层共用
+func Validate(conf *GlobalConfig, customConfigs map[string]interface{}, validatorMap map[string]validator.Func) error {
+	v, err := newConfigValidator(validatorMap)
+	if err != nil {
+		return err
+	}
+	result := &ValidationError{}
+	if err = collectFieldErrors(v, GlobalSection, conf, result); err != nil {
+		return err
+	}
+	// mysql即为默认数据源,不能在datasources中重复配置
+	if conf.MySQL != nil && conf.DataSources[DefaultDataSource] != nil {
+		result.Fields = append(
+			result.Fields,
+			FieldError{Section: GlobalSection, Field: "datasources." + DefaultDataSource, Rule: "excluded_with", Param: "mysql"},
+		)
+	}
+	// redis即为默认Redis实例,不能在redis-instances中重复配置
+	if conf.Redis != nil && conf.RedisInstances[DefaultRedis] != nil {
+		result.Fields = append(
+			result.Fields,
+			FieldError{Section: GlobalSection, Field: "redis-instances." + DefaultRedis, Rule: "excluded_with", Param: "redis"},
+		)
+	}
+	names := make([]string, 0, len(customConfigs))
+	for name := range customConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = collectFieldErrors(v, name, customConfigs[name], result); err != nil {
+			return err
+		}
+	}
+	if len(result.Fields) > 0 {
+		return result
+	}
+	return nil
+}
+
+// collectFieldErrors 校验单个配置结构体并收集字段错误,非结构体配置忽略
+func collectFieldErrors(v *validator.Validate, section string, conf interface{}, result *ValidationError) error {
+	err := v.Struct(conf)
+	if err == nil {
+		return nil
+	}
+	var invalidErr *validator.InvalidValidationError
+	if errors.As(err, &invalidErr) {
+		return nil
+	}
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+	for _, fieldErr := range validationErrs {
+		// 去掉命名空间中的结构体类型名,如 GlobalConfig.mysql.port → mysql.port
+		field := fieldErr.Namespace()
+		if _, rest, found := strings.Cut(field, "."); found {
+			field = rest
+		}
+		result.Fields = append(
+			result.Fields, FieldError{Section: section, Field: field, Rule: fieldErr.Tag(), Param: fieldErr.Param()},
+		)
+	}
+	return nil
+}
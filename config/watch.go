@@ -0,0 +1,200 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/SUPERDBFMP/go-base/trace"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigChange 配置段变更信息
+type ConfigChange struct {
+	DataId      string      // 变更的data id
+	Old         interface{} // 变更前的配置,与配置段类型一致,如 *MySqlConfig
+	New         interface{} // 变更后的配置
+	ChangedKeys []string    // 发生变化的key,如 max-conn、pool.size
+}
+
+// ConfigChangeListener 配置变更监听器,配置已校验并生效后回调
+type ConfigChangeListener func(ctx context.Context, change *ConfigChange)
+
+var (
+	changeMutex     sync.Mutex
+	changeListeners []ConfigChangeListener
+	watchValidators map[string]validator.Func
+)
+
+// AddConfigChangeListener 添加配置变更监听器
+func AddConfigChangeListener(listener ConfigChangeListener) {
+	changeMutex.Lock()
+	defer changeMutex.Unlock()
+	changeListeners = append(changeListeners, listener)
+}
+
+// watchSections 监听各配置段在各配置源中的变更
+func watchSections(sections []*section, validatorMap map[string]validator.Func) error {
+	watchValidators = validatorMap
+	for _, s := range sections {
+		for _, r := range s.remotes {
+			s, r := s, r
+			if err := r.source.Watch(r.dataId, r.group, func(data string) { onRemoteChange(s, r, data, false) }); err != nil {
+				return fmt.Errorf("watch config data id[%s] from %s errs: %w", s.dataId, r.source.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// onRemoteChange 配置源中的配置变更后重新合并、校验并比较配置,有变化时生效并通知监听器,配置无效时返回false,
+// resync为true表示配置源恢复可用后重新同步,此时内容为空表示配置源中没有该配置
+func onRemoteChange(s *section, r *remote, data string, resync bool) bool {
+	ctx := context.WithValue(context.Background(), trace.TraceIdKey, trace.GenerateTraceId())
+	changeMutex.Lock()
+	if data == "" {
+		if resync {
+			r.degraded = false
+			saveSnapshot(r.source, r.dataId, r.group, data)
+			sectionSources[s.dataId] = s.kind()
+		} else {
+			logrus.Warnf("Config data id[%s] from %s changed to blank,ignore", s.dataId, r.source.Name())
+		}
+		changeMutex.Unlock()
+		return resync
+	}
+	// 变更后的配置同样按优先级覆盖在默认配置与本地配置之上
+	tree, err := s.merge(r, data)
+	if err != nil {
+		changeMutex.Unlock()
+		logrus.Warnf("Parse changed config data id[%s] errs: %v,ignore", s.dataId, err)
+		return false
+	}
+	newValue, err := s.decode(tree)
+	if err != nil {
+		changeMutex.Unlock()
+		logrus.Warnf("Parse changed config data id[%s] errs: %v,ignore", s.dataId, err)
+		return false
+	}
+	if err := validateSection(s.dataId, newValue, watchValidators); err != nil {
+		changeMutex.Unlock()
+		logrus.Warnf("Validate changed config data id[%s] errs: %v,ignore", s.dataId, err)
+		return false
+	}
+	oldValue := s.current(GlobalConf)
+	changedKeys, err := diffConfig(oldValue, newValue)
+	if err != nil {
+		changeMutex.Unlock()
+		logrus.Warnf("Diff changed config data id[%s] errs: %v,ignore", s.dataId, err)
+		return false
+	}
+	// 保存最近一次有效配置的快照
+	saveSnapshot(r.source, r.dataId, r.group, data)
+	r.content, r.degraded = data, false
+	if _, ok := sectionSources[s.dataId]; ok || len(changedKeys) > 0 {
+		sectionSources[s.dataId] = s.kind()
+	}
+	if len(changedKeys) == 0 {
+		changeMutex.Unlock()
+		return true
+	}
+	s.apply(GlobalConf, newValue)
+	listeners := append([]ConfigChangeListener{}, changeListeners...)
+	changeMutex.Unlock()
+
+	logrus.Infof("Config data id[%s] changed keys: %v", s.dataId, changedKeys)
+	change := &ConfigChange{DataId: s.dataId, Old: oldValue, New: newValue, ChangedKeys: changedKeys}
+	for _, listener := range listeners {
+		listener(ctx, change)
+	}
+	return true
+}
+
+// diffConfig 比较两个配置,返回按yaml key路径表示的变化项
+func diffConfig(oldValue, newValue interface{}) ([]string, error) {
+	oldFlat, err := flattenConfig(oldValue)
+	if err != nil {
+		return nil, err
+	}
+	newFlat, err := flattenConfig(newValue)
+	if err != nil {
+		return nil, err
+	}
+	var changedKeys []string
+	for key, value := range newFlat {
+		if oldVal, ok := oldFlat[key]; !ok || !reflect.DeepEqual(oldVal, value) {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+	for key := range oldFlat {
+		if _, ok := newFlat[key]; !ok {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+	sort.Strings(changedKeys)
+	return changedKeys, nil
+}
+
+// flattenConfig 将配置展开为以点分隔路径为key的map
+func flattenConfig(value interface{}) (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return flat, nil
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]interface{})
+	if err = yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	paths := make(map[string][]string)
+	collectTreePaths(tree, nil, paths)
+	for key, path := range paths {
+		var current interface{} = tree
+		for _, segment := range path {
+			current = current.(map[string]interface{})[segment]
+		}
+		flat[key] = current
+	}
+	return flat, nil
+}
+
+// validateSection 校验单个配置段
+func validateSection(name string, value interface{}, validatorMap map[string]validator.Func) error {
+	v, err := newConfigValidator(validatorMap)
+	if err != nil {
+		return err
+	}
+	result := &ValidationError{}
+	mapValue := reflect.Indirect(reflect.ValueOf(value))
+	if mapValue.Kind() != reflect.Map {
+		if err = collectFieldErrors(v, name, value, result); err != nil {
+			return err
+		}
+	} else {
+		// map类型的配置段逐项校验,如各数据源
+		keys := mapValue.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			entryResult := &ValidationError{}
+			if err = collectFieldErrors(v, name, mapValue.MapIndex(key).Interface(), entryResult); err != nil {
+				return err
+			}
+			for _, field := range entryResult.Fields {
+				field.Field = key.String() + "." + field.Field
+				result.Fields = append(result.Fields, field)
+			}
+		}
+	}
+	if len(result.Fields) > 0 {
+		return result
+	}
+	return nil
+}
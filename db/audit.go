@@ -0,0 +1,333 @@
+package db
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/SUPERDBFMP/go-base/config"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// softDeleteEnabled 与gorm的DeletedAt使用相同的标记,避免重复添加条件,
+// gorm检查更新是否缺少条件时不把逻辑删除条件计入调用方的条件
+const softDeleteEnabled = "soft_delete_enabled"
+
+// operatorKey context中的当前操作人
+type operatorKey struct{}
+
+// WithOperator 返回携带当前操作人ID的context,插入时写入创建人与更新人,更新与逻辑删除时写入更新人
+func WithOperator(ctx context.Context, operator any) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+// Operator 获取context中的当前操作人ID
+func Operator(ctx context.Context) (any, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	operator := ctx.Value(operatorKey{})
+	return operator, operator != nil
+}
+
+// auditColumns 数据源的审计字段与逻辑删除字段列名,为空表示不启用
+type auditColumns struct {
+	createTime string
+	updateTime string
+	createBy   string
+	updateBy   string
+	softDelete string
+}
+
+// registerAudit 注册审计字段填充与逻辑删除回调
+func registerAudit(db *gorm.DB, mysqlConfig *config.MySqlConfig) error {
+	a := &auditColumns{
+		createTime: mysqlConfig.CreateTimeColumn,
+		updateTime: mysqlConfig.UpdateTimeColumn,
+		createBy:   mysqlConfig.CreateByColumn,
+		updateBy:   mysqlConfig.UpdateByColumn,
+		softDelete: mysqlConfig.SoftDeleteColumn,
+	}
+	callback := db.Callback()
+	if err := callback.Create().Before("gorm:create").Register("base:audit_create", a.beforeCreate); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("base:audit_update", a.beforeUpdate); err != nil {
+		return err
+	}
+	if err := callback.Query().Before("gorm:query").Register("base:soft_delete_query", a.beforeQuery); err != nil {
+		return err
+	}
+	if err := callback.Row().Before("gorm:row").Register("base:soft_delete_query", a.beforeQuery); err != nil {
+		return err
+	}
+	return callback.Delete().Before("gorm:delete").Register("base:soft_delete", a.beforeDelete)
+}
+
+// lookUpField 实体中指定列名的字段,列名为空或实体中不存在时返回nil
+func lookUpField(stmt *gorm.Statement, column string) *schema.Field {
+	if column == "" || stmt.Schema == nil {
+		return nil
+	}
+	return stmt.Schema.LookUpField(column)
+}
+
+// beforeCreate 为未设置的创建时间、更新时间、创建人与更新人赋值
+func (a *auditColumns) beforeCreate(d *gorm.DB) {
+	stmt := d.Statement
+	if stmt.Schema == nil || stmt.SkipHooks {
+		return
+	}
+	now := d.NowFunc()
+	a.onConflictUpdate(stmt)
+	values := make(map[*schema.Field]interface{})
+	for _, column := range []string{a.createTime, a.updateTime} {
+		if field := lookUpField(stmt, column); field != nil {
+			values[field] = now
+		}
+	}
+	if operator, ok := Operator(stmt.Context); ok {
+		for _, column := range []string{a.createBy, a.updateBy} {
+			if field := lookUpField(stmt, column); field != nil {
+				values[field] = operator
+			}
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	reflectValue := reflect.Indirect(stmt.ReflectValue)
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < reflectValue.Len(); i++ {
+			if err := setZeroFields(stmt.Context, reflectValue.Index(i), values); err != nil {
+				_ = d.AddError(err)
+				return
+			}
+		}
+	default:
+		if err := setZeroFields(stmt.Context, reflectValue, values); err != nil {
+			_ = d.AddError(err)
+		}
+	}
+}
+
+// onConflictUpdate 插入冲突时更新的列中去掉创建时间与创建人,并加入更新时间与更新人
+func (a *auditColumns) onConflictUpdate(stmt *gorm.Statement) {
+	c, ok := stmt.Clauses["ON CONFLICT"]
+	if !ok {
+		return
+	}
+	onConflict, ok := c.Expression.(clause.OnConflict)
+	if !ok || len(onConflict.DoUpdates) == 0 {
+		return
+	}
+	skipped := make(map[string]bool)
+	for _, column := range []string{a.createTime, a.createBy} {
+		if field := lookUpField(stmt, column); field != nil {
+			skipped[field.DBName] = true
+		}
+	}
+	updates := make(clause.Set, 0, len(onConflict.DoUpdates)+2)
+	for _, assignment := range onConflict.DoUpdates {
+		if !skipped[assignment.Column.Name] {
+			updates = append(updates, assignment)
+			skipped[assignment.Column.Name] = true
+		}
+	}
+	columns := []string{a.updateTime}
+	if _, ok := Operator(stmt.Context); ok {
+		columns = append(columns, a.updateBy)
+	}
+	for _, column := range columns {
+		if field := lookUpField(stmt, column); field != nil && !skipped[field.DBName] {
+			updates = append(updates, clause.AssignmentColumns([]string{field.DBName})...)
+		}
+	}
+	onConflict.DoUpdates = updates
+	c.Expression = onConflict
+	stmt.Clauses["ON CONFLICT"] = c
+}
+
+// setZeroFields 为单条记录中值为零值的字段赋值,map形式的记录只为不存在的列赋值
+func setZeroFields(ctx context.Context, elem reflect.Value, values map[*schema.Field]interface{}) error {
+	for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+		if elem.IsNil() {
+			return nil
+		}
+		elem = elem.Elem()
+	}
+	switch elem.Kind() {
+	case reflect.Struct:
+		for field, value := range values {
+			if _, isZero := field.ValueOf(ctx, elem); !isZero {
+				continue
+			}
+			if err := field.Set(ctx, elem, value); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if m, ok := elem.Interface().(map[string]interface{}); ok {
+			for field, value := range values {
+				_, byName := m[field.Name]
+				if _, byColumn := m[field.DBName]; !byName && !byColumn {
+					m[field.DBName] = value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// beforeUpdate 写入更新时间与更新人,忽略对创建时间与创建人的修改,并过滤已逻辑删除的记录
+func (a *auditColumns) beforeUpdate(d *gorm.DB) {
+	stmt := d.Statement
+	if stmt.Schema == nil {
+		return
+	}
+	if field := a.softDeleteField(stmt); field != nil {
+		addSoftDeleteCondition(stmt, field)
+	}
+	if stmt.SkipHooks {
+		return
+	}
+	for _, column := range []string{a.createTime, a.createBy} {
+		if field := lookUpField(stmt, column); field != nil {
+			stmt.Omits = append(stmt.Omits, field.DBName)
+		}
+	}
+	if field := lookUpField(stmt, a.updateTime); field != nil {
+		setUpdateColumn(stmt, field, d.NowFunc())
+	}
+	if field := lookUpField(stmt, a.updateBy); field != nil {
+		if operator, ok := Operator(stmt.Context); ok {
+			setUpdateColumn(stmt, field, operator)
+		}
+	}
+}
+
+// setUpdateColumn 设置更新的列,指定了Select时将该列加入Select,
+// 按map的指针更新时gorm的SetColumn不支持,直接写入map
+func setUpdateColumn(stmt *gorm.Statement, field *schema.Field, value interface{}) {
+	if dest := reflect.Indirect(reflect.ValueOf(stmt.Dest)); dest.IsValid() && dest.Type() == reflect.TypeOf(map[string]interface{}{}) {
+		dest.SetMapIndex(reflect.ValueOf(field.DBName), reflect.ValueOf(value))
+	} else {
+		stmt.SetColumn(field.DBName, value, true)
+	}
+	if len(stmt.Selects) == 0 {
+		return
+	}
+	for _, selected := range stmt.Selects {
+		if selected == "*" || selected == field.DBName || selected == field.Name {
+			return
+		}
+	}
+	stmt.Selects = append(stmt.Selects, field.DBName)
+}
+
+// beforeQuery 查询时过滤已逻辑删除的记录
+func (a *auditColumns) beforeQuery(d *gorm.DB) {
+	if field := a.softDeleteField(d.Statement); field != nil {
+		addSoftDeleteCondition(d.Statement, field)
+	}
+}
+
+// beforeDelete 实体存在逻辑删除列时将删除改为更新逻辑删除列,同时写入更新时间与更新人,
+// 与gorm的物理删除一致,未设置AllowGlobalUpdate时不带条件且没有主键的删除返回gorm.ErrMissingWhereClause
+func (a *auditColumns) beforeDelete(d *gorm.DB) {
+	stmt := d.Statement
+	field := a.softDeleteField(stmt)
+	if field == nil || stmt.SQL.Len() > 0 {
+		return
+	}
+	now := d.NowFunc()
+	var deleted interface{} = now
+	switch fieldKind(field) {
+	case reflect.Bool:
+		deleted = true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		deleted = 1
+	}
+	set := clause.Set{{Column: clause.Column{Name: field.DBName}, Value: deleted}}
+	if updateTime := lookUpField(stmt, a.updateTime); updateTime != nil {
+		set = append(set, clause.Assignment{Column: clause.Column{Name: updateTime.DBName}, Value: now})
+	}
+	if updateBy := lookUpField(stmt, a.updateBy); updateBy != nil {
+		if operator, ok := Operator(stmt.Context); ok {
+			set = append(set, clause.Assignment{Column: clause.Column{Name: updateBy.DBName}, Value: operator})
+		}
+	}
+	// 与物理删除一致,传入的实体或Model带有主键时按主键删除
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	if len(values) > 0 {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+	}
+	if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+		_, queryValues = schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(stmt.Model), stmt.Schema.PrimaryFields)
+		column, values = schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: values}}})
+		}
+	}
+	if _, ok := stmt.Clauses["WHERE"]; !ok && !d.AllowGlobalUpdate {
+		_ = d.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	stmt.AddClause(set)
+	addSoftDeleteCondition(stmt, field)
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build(d.Callback().Update().Clauses...)
+}
+
+// softDeleteField 实体的逻辑删除字段,未启用、实体中不存在该列、使用gorm.DeletedAt或Unscoped时返回nil
+func (a *auditColumns) softDeleteField(stmt *gorm.Statement) *schema.Field {
+	if stmt.Unscoped {
+		return nil
+	}
+	field := lookUpField(stmt, a.softDelete)
+	if field == nil || field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+		return nil
+	}
+	return field
+}
+
+// addSoftDeleteCondition 添加未删除的条件,整数与布尔类型的列为零值,时间类型的列为NULL,
+// 已有OR条件时先将原条件整体作为一个AND条件,避免优先级错误
+func addSoftDeleteCondition(stmt *gorm.Statement, field *schema.Field) {
+	if _, ok := stmt.Clauses[softDeleteEnabled]; ok {
+		return
+	}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) >= 1 {
+			for _, expr := range where.Exprs {
+				if orCond, ok := expr.(clause.OrConditions); ok && len(orCond.Exprs) == 1 {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+	var notDeleted interface{}
+	switch fieldKind(field) {
+	case reflect.Bool:
+		notDeleted = false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		notDeleted = 0
+	}
+	stmt.AddClause(
+		clause.Where{
+			Exprs: []clause.Expression{
+				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: notDeleted},
+			},
+		},
+	)
+	stmt.Clauses[softDeleteEnabled] = clause.Clause{}
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+
+	"github.com/SUPERDBFMP/gorm-plus-enhanced/gplus"
+	"gorm.io/gorm"
+)
+
+type auditRecord struct {
+	Id         int64 `gorm:"primaryKey"`
+	Name       string
+	CreateTime time.Time
+	UpdateTime time.Time
+	CreateBy   int64
+	UpdateBy   int64
+	Deleted    int
+}
+
+var auditConfig = &config.MySqlConfig{
+	CreateTimeColumn: "create_time",
+	UpdateTimeColumn: "update_time",
+	CreateByColumn:   "create_by",
+	UpdateByColumn:   "update_by",
+	SoftDeleteColumn: "deleted",
+}
+
+func TestAuditColumns(t *testing.T) {
+	db := openTestDB(t, auditConfig, &auditRecord{})
+	ctx := context.Background()
+
+	record := &auditRecord{Name: "a"}
+	if err := db.WithContext(WithOperator(ctx, int64(1))).Create(record).Error; err != nil {
+		t.Fatal(err)
+	}
+	if record.CreateBy != 1 || record.UpdateBy != 1 || record.CreateTime.IsZero() || record.UpdateTime.IsZero() {
+		t.Fatalf("audit columns not filled on create: %+v", record)
+	}
+	created := record.CreateTime
+
+	time.Sleep(time.Millisecond)
+	update := &auditRecord{Name: "b", CreateTime: created.Add(-time.Hour), CreateBy: 99}
+	if err := db.WithContext(WithOperator(ctx, int64(2))).Model(&auditRecord{Id: record.Id}).Updates(update).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&auditRecord{Id: record.Id}).Updates(map[string]interface{}{"create_by": 98}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var loaded auditRecord
+	if err := db.First(&loaded, record.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "b" || loaded.CreateBy != 1 || !loaded.CreateTime.Equal(created) {
+		t.Fatalf("create columns changed by update: %+v", loaded)
+	}
+	if loaded.UpdateBy != 2 || !loaded.UpdateTime.After(created) {
+		t.Fatalf("update columns not filled on update: %+v", loaded)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	db := openTestDB(t, auditConfig, &auditRecord{})
+	ctx := WithOperator(context.Background(), int64(3))
+	records := []*auditRecord{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	if err := db.Create(records).Error; err != nil {
+		t.Fatal(err)
+	}
+	countAlive := func(t *testing.T) int64 {
+		t.Helper()
+		var count int64
+		if err := db.Model(&auditRecord{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	// 按实体的主键删除
+	if err := db.WithContext(ctx).Delete(&auditRecord{Id: records[0].Id}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&auditRecord{}, records[0].Id).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("err = %v, want soft deleted record hidden", err)
+	}
+	var deleted auditRecord
+	if err := db.Unscoped().First(&deleted, records[0].Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Deleted != 1 || deleted.UpdateBy != 3 {
+		t.Fatalf("record not soft deleted: %+v", deleted)
+	}
+	if count := countAlive(t); count != 2 {
+		t.Fatalf("count = %d, want 2", count)
+	}
+
+	// 不带条件的删除被拒绝
+	if err := db.Delete(&auditRecord{}).Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("err = %v, want ErrMissingWhereClause", err)
+	}
+	// gplus.Delete不返回执行时的错误,只检查没有记录被删除
+	query, _ := gplus.NewQuery[auditRecord]()
+	_ = NewBaseDao[auditRecord]().Delete(ctx, query)
+	if count := countAlive(t); count != 2 {
+		t.Fatalf("count = %d, want 2 after rejected deletes", count)
+	}
+
+	// 按条件删除
+	if err := db.Where("name = ?", "b").Delete(&auditRecord{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count := countAlive(t); count != 1 {
+		t.Fatalf("count = %d, want 1", count)
+	}
+	if err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&auditRecord{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	if err := db.Unscoped().Model(&auditRecord{}).Count(&total).Error; err != nil || total != 3 || countAlive(t) != 0 {
+		t.Fatalf("total = %d, err = %v, want all 3 records soft deleted", total, err)
+	}
+}
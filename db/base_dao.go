@@ -3,12 +3,34 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/SUPERDBFMP/go-base/config"
 
 	"github.com/SUPERDBFMP/gorm-plus-enhanced/gplus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 type BaseDao[T any] struct {
+	dataSource string // 绑定的数据源名称,为空时使用默认数据源
+}
+
+// DaoOption BaseDao选项
+type DaoOption func(*daoOptions)
+
+type daoOptions struct {
+	dataSource string
+}
+
+// WithDataSource 绑定指定名称的数据源,即datasources中的key
+func WithDataSource(name string) DaoOption {
+	return func(o *daoOptions) {
+		o.dataSource = name
+	}
 }
 
 type BaseDaoWithComparable[T any, V gplus.Comparable] struct {
@@ -23,8 +45,74 @@ type BaseDaoStreamingGeneric[T any, R any, V gplus.Comparable] struct {
 	*BaseDao[T]
 }
 
-func NewBaseDao[T any]() *BaseDao[T] {
-	return &BaseDao[T]{}
+func NewBaseDao[T any](opts ...DaoOption) *BaseDao[T] {
+	var options daoOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &BaseDao[T]{dataSource: options.dataSource}
+}
+
+// dataSourceName 绑定的数据源名称,未绑定时为默认数据源
+func (b *BaseDao[T]) dataSourceName() string {
+	if b != nil && b.dataSource != "" {
+		return b.dataSource
+	}
+	return config.DefaultDataSource
+}
+
+// withDb 将ctx中绑定数据源的事务或绑定的数据源放在opts最前面,调用方通过gplus.Db传入的Db优先
+func (b *BaseDao[T]) withDb(ctx context.Context, opts []gplus.OptionFunc) ([]gplus.OptionFunc, error) {
+	name := b.dataSourceName()
+	if tc := txFromContext(ctx, name); tc != nil {
+		return append([]gplus.OptionFunc{gplus.Db(tc.tx)}, opts...), nil
+	}
+	if name == config.DefaultDataSource {
+		return opts, nil
+	}
+	db := Get(name)
+	if db == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDataSourceNotFound, name)
+	}
+	return append([]gplus.OptionFunc{gplus.Db(db)}, opts...), nil
+}
+
+// withClauses 在opts最终使用的Db上执行build,如添加ON DUPLICATE KEY UPDATE子句或排序,放在opts最后保证生效
+func (b *BaseDao[T]) withClauses(
+	ctx context.Context, opts []gplus.OptionFunc, build func(db *gorm.DB) *gorm.DB) ([]gplus.OptionFunc, error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var option gplus.Option
+	for _, opt := range opts {
+		opt(&option)
+	}
+	db := option.Db
+	if db == nil {
+		if db = Get(config.DefaultDataSource); db == nil {
+			return nil, fmt.Errorf("%w: %s", ErrDataSourceNotFound, config.DefaultDataSource)
+		}
+	}
+	return append(opts, gplus.Db(build(db))), nil
+}
+
+// parseSchema 解析实体的表结构
+func (b *BaseDao[T]) parseSchema(ctx context.Context, opts []gplus.OptionFunc) (*schema.Schema, error) {
+	var db *gorm.DB
+	if _, err := b.withClauses(
+		ctx, opts, func(d *gorm.DB) *gorm.DB {
+			db = d
+			return d
+		},
+	); err != nil {
+		return nil, err
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
 }
 
 // NewQueryCond 创建查询条件
@@ -32,22 +120,26 @@ func (b *BaseDao[T]) NewQueryCond() (*gplus.QueryCond[T], *T) {
 	return gplus.NewQuery[T]()
 }
 
-func NewBaseDaoWithComparable[T any, V gplus.Comparable]() *BaseDaoWithComparable[T, V] {
-	return &BaseDaoWithComparable[T, V]{BaseDao: NewBaseDao[T]()}
+func NewBaseDaoWithComparable[T any, V gplus.Comparable](opts ...DaoOption) *BaseDaoWithComparable[T, V] {
+	return &BaseDaoWithComparable[T, V]{BaseDao: NewBaseDao[T](opts...)}
 }
 
-func NewBaseDaoGeneric[T any, R any]() *BaseDaoGeneric[T, R] {
-	return &BaseDaoGeneric[T, R]{BaseDao: NewBaseDao[T]()}
+func NewBaseDaoGeneric[T any, R any](opts ...DaoOption) *BaseDaoGeneric[T, R] {
+	return &BaseDaoGeneric[T, R]{BaseDao: NewBaseDao[T](opts...)}
 }
 
-func NewBaseDaoStreamingGeneric[T any, R any, V gplus.Comparable]() *BaseDaoStreamingGeneric[T, R, V] {
-	return &BaseDaoStreamingGeneric[T, R, V]{BaseDao: NewBaseDao[T]()}
+func NewBaseDaoStreamingGeneric[T any, R any, V gplus.Comparable](opts ...DaoOption) *BaseDaoStreamingGeneric[T, R, V] {
+	return &BaseDaoStreamingGeneric[T, R, V]{BaseDao: NewBaseDao[T](opts...)}
 }
 
 //---------------------------------------------------查询------------------------------------------------------//
 
 // SelectById 根据 ID 查询单条记录
 func (b *BaseDao[T]) SelectById(ctx context.Context, id any, opts ...gplus.OptionFunc) (*T, error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	result, db := gplus.SelectById[T](ctx, id, opts...)
 	if db.Error != nil {
 		if errors.Is(db.Error, gorm.ErrRecordNotFound) {
@@ -61,12 +153,20 @@ func (b *BaseDao[T]) SelectById(ctx context.Context, id any, opts ...gplus.Optio
 
 // SelectByIds 根据 ID 查询多条记录
 func (b *BaseDao[T]) SelectByIds(ctx context.Context, ids any, opts ...gplus.OptionFunc) ([]*T, error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	result, db := gplus.SelectByIds[T](ctx, ids, opts...)
 	return result, db.Error
 }
 
 // SelectOne 根据条件查询单条记录
 func (b *BaseDao[T]) SelectOne(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) (*T, error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	result, db := gplus.SelectOne[T](ctx, q, opts...)
 	if db.Error != nil {
 		if errors.Is(db.Error, gorm.ErrRecordNotFound) {
@@ -80,6 +180,10 @@ func (b *BaseDao[T]) SelectOne(ctx context.Context, q *gplus.QueryCond[T], opts
 
 // SelectList 根据条件查询多条记录
 func (b *BaseDao[T]) SelectList(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) ([]*T, error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	results, db := gplus.SelectList[T](ctx, q, opts...)
 	return results, db.Error
 }
@@ -88,6 +192,10 @@ func (b *BaseDao[T]) SelectList(ctx context.Context, q *gplus.QueryCond[T], opts
 func (b *BaseDao[T]) SelectPage(
 	ctx context.Context, page *gplus.Page[T], q *gplus.QueryCond[T], opts ...gplus.OptionFunc) (
 	*gplus.Page[T], error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	page, db := gplus.SelectPage[T](ctx, page, q, opts...)
 	return page, db.Error
 }
@@ -96,6 +204,10 @@ func (b *BaseDao[T]) SelectPage(
 func (b *BaseDaoWithComparable[T, V]) SelectStreamingPage(
 	ctx context.Context, page *gplus.StreamingPage[T, V], q *gplus.QueryCond[T], opts ...gplus.OptionFunc) (
 	*gplus.StreamingPage[T, V], error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	result, db := gplus.SelectStreamingPage[T, V](ctx, page, q, opts...)
 	if db.Error != nil {
 		return nil, db.Error
@@ -103,8 +215,118 @@ func (b *BaseDaoWithComparable[T, V]) SelectStreamingPage(
 	return result, nil
 }
 
+// Iterate 按主键升序分批遍历符合条件的记录,使用 主键 > 上一批最大主键 翻页而不是OFFSET,适用于遍历大表,
+// q中不能指定排序与分页,fn返回错误时停止遍历并返回该错误,实体需有单一主键且类型为V
+func (b *BaseDaoWithComparable[T, V]) Iterate(
+	ctx context.Context, q *gplus.QueryCond[T], batchSize int, fn func(records []*T) error,
+	opts ...gplus.OptionFunc) error {
+	return b.IterateConcurrently(ctx, q, batchSize, 1, fn, opts...)
+}
+
+// IterateConcurrently 与Iterate相同,但最多同时有concurrency个fn在处理不同的批次,用于回填数据等任务,
+// 批次仍按主键顺序查询,fn的执行顺序不确定,任一fn返回错误时不再查询后续批次,等待已开始的fn结束后返回该错误
+func (b *BaseDaoWithComparable[T, V]) IterateConcurrently(
+	ctx context.Context, q *gplus.QueryCond[T], batchSize int, concurrency int, fn func(records []*T) error,
+	opts ...gplus.OptionFunc) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("batchSize必须大于0,当前为%d", batchSize)
+	}
+	s, err := b.parseSchema(ctx, opts)
+	if err != nil {
+		return err
+	}
+	field := s.PrioritizedPrimaryField
+	if field == nil {
+		return fmt.Errorf("实体%s没有单一主键,无法按主键遍历", s.Name)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var (
+		wg       sync.WaitGroup
+		workers  = make(chan struct{}, max(concurrency, 1))
+		start    V
+		started  bool
+		iterOpts = append(append([]gplus.OptionFunc{}, opts...), gplus.IgnoreTotal())
+	)
+	err = func() error {
+		for {
+			pageOpts, err := b.withClauses(
+				ctx, iterOpts, func(db *gorm.DB) *gorm.DB {
+					return db.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}})
+				},
+			)
+			if err != nil {
+				return err
+			}
+			records, err := b.iteratePage(ctx, q, field.DBName, start, started, batchSize, pageOpts)
+			if err != nil {
+				return err
+			}
+			if len(records) == 0 {
+				return nil
+			}
+			started = true
+			last, _ := field.ValueOf(ctx, reflect.ValueOf(records[len(records)-1]).Elem())
+			value, ok := last.(V)
+			if !ok {
+				return fmt.Errorf("实体%s的主键类型为%T,与%T不一致", s.Name, last, start)
+			}
+			start = value
+			if concurrency <= 1 {
+				if err = fn(records); err != nil {
+					return err
+				}
+			} else {
+				select {
+				case workers <- struct{}{}:
+				case <-ctx.Done():
+					return nil
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-workers }()
+					if err := fn(records); err != nil {
+						cancel(err)
+					}
+				}()
+			}
+			if len(records) < batchSize {
+				return nil
+			}
+		}
+	}()
+	wg.Wait()
+	if cause := context.Cause(ctx); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// iteratePage 查询遍历的一批记录,第一批不带主键下限,之后查询主键大于上一批最大主键的记录
+func (b *BaseDaoWithComparable[T, V]) iteratePage(
+	ctx context.Context, q *gplus.QueryCond[T], column string, start V, started bool, batchSize int,
+	opts []gplus.OptionFunc) ([]*T, error) {
+	if !started {
+		page, err := b.SelectPage(ctx, gplus.NewPage[T](1, batchSize), q, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return page.Records, nil
+	}
+	page, err := b.SelectStreamingPage(ctx, gplus.NewStreamingPage[T, V](column, start, batchSize), q, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return page.Records, nil
+}
+
 // SelectCount 根据条件查询记录数量
 func (b *BaseDao[T]) SelectCount(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) (int64, error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
 	var count int64
 	count, db := gplus.SelectCount[T](ctx, q, opts...)
 	return count, db.Error
@@ -122,6 +344,10 @@ func (b *BaseDao[T]) Exists(ctx context.Context, q *gplus.QueryCond[T], opts ...
 func (b *BaseDaoGeneric[T, R]) SelectPageGeneric(
 	ctx context.Context, page *gplus.Page[R], q *gplus.QueryCond[T], opts ...gplus.OptionFunc) (
 	*gplus.Page[R], error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	result, db := gplus.SelectPageGeneric[T, R](ctx, page, q, opts...)
 	if db.Error != nil {
 		return nil, db.Error
@@ -135,6 +361,10 @@ func (b *BaseDaoGeneric[T, R]) SelectPageGeneric(
 func (b *BaseDaoStreamingGeneric[T, R, V]) SelectStreamingPageGeneric(
 	ctx context.Context, page *gplus.StreamingPage[R, V], q *gplus.QueryCond[T], opts ...gplus.OptionFunc) (
 	*gplus.StreamingPage[R, V], error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 	result, db := gplus.SelectStreamingPageGeneric[T, R, V](ctx, page, q, opts...)
 	if db.Error != nil {
 		return nil, db.Error
@@ -147,6 +377,11 @@ func (b *BaseDaoStreamingGeneric[T, R, V]) SelectStreamingPageGeneric(
 // 第二个泛型代表返回记录实体
 func (b *BaseDaoGeneric[T, R]) SelectGeneric(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) (
 	R, error) {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		var zero R
+		return zero, err
+	}
 	result, db := gplus.SelectGeneric[T, R](ctx, q, opts...)
 	return result, db.Error
 }
@@ -155,34 +390,100 @@ func (b *BaseDaoGeneric[T, R]) SelectGeneric(ctx context.Context, q *gplus.Query
 
 // Insert 插入一条记录
 func (b *BaseDao[T]) Insert(ctx context.Context, entity *T, opts ...gplus.OptionFunc) error {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.Insert[T](ctx, entity, opts...).Error
 }
 
 // InsertBatch 批量插入多条记录
 func (b *BaseDao[T]) InsertBatch(ctx context.Context, entities []*T, opts ...gplus.OptionFunc) error {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.InsertBatch[T](ctx, entities, opts...).Error
 }
 
 // InsertBatchSize 批量插入多条记录
 func (b *BaseDao[T]) InsertBatchSize(
 	ctx context.Context, entities []*T, batchSize int, opts ...gplus.OptionFunc) error {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.InsertBatchSize[T](ctx, entities, batchSize, opts...).Error
 }
 
+// InsertOrUpdate 插入一条记录,主键或唯一索引冲突时更新columns指定的列(ON DUPLICATE KEY UPDATE),
+// columns为空时更新除主键外的所有列,创建时间与创建人不会被更新
+func (b *BaseDao[T]) InsertOrUpdate(ctx context.Context, entity *T, columns []string, opts ...gplus.OptionFunc) error {
+	opts, err := b.withOnConflict(ctx, columns, opts)
+	if err != nil {
+		return err
+	}
+	return gplus.Insert[T](ctx, entity, opts...).Error
+}
+
+// InsertOrUpdateBatch 批量插入多条记录,主键或唯一索引冲突时更新columns指定的列,规则与InsertOrUpdate相同
+func (b *BaseDao[T]) InsertOrUpdateBatch(
+	ctx context.Context, entities []*T, columns []string, opts ...gplus.OptionFunc) error {
+	opts, err := b.withOnConflict(ctx, columns, opts)
+	if err != nil {
+		return err
+	}
+	return gplus.InsertBatch[T](ctx, entities, opts...).Error
+}
+
+// withOnConflict 添加冲突时更新的子句
+func (b *BaseDao[T]) withOnConflict(
+	ctx context.Context, columns []string, opts []gplus.OptionFunc) ([]gplus.OptionFunc, error) {
+	if len(columns) == 0 {
+		s, err := b.parseSchema(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range s.Fields {
+			if field.DBName != "" && !field.PrimaryKey && field.Creatable && field.Updatable && field.AutoCreateTime == 0 {
+				columns = append(columns, field.DBName)
+			}
+		}
+	}
+	onConflict := clause.OnConflict{DoUpdates: clause.AssignmentColumns(columns)}
+	return b.withClauses(
+		ctx, opts, func(db *gorm.DB) *gorm.DB {
+			return db.Clauses(onConflict)
+		},
+	)
+}
+
 //---------------------------------------------------删除------------------------------------------------------//
 
 // DeleteById 根据 ID 删除记录
 func (b *BaseDao[T]) DeleteById(ctx context.Context, id any, opts ...gplus.OptionFunc) error {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.DeleteById[T](ctx, id, opts...).Error
 }
 
 // DeleteByIds 根据 ID 批量删除记录
 func (b *BaseDao[T]) DeleteByIds(ctx context.Context, ids any, opts ...gplus.OptionFunc) error {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.DeleteByIds[T](ctx, ids, opts...).Error
 }
 
 // Delete 根据条件删除记录
 func (b *BaseDao[T]) Delete(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) error {
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.Delete[T](ctx, q, opts...).Error
 }
 
@@ -190,18 +491,72 @@ func (b *BaseDao[T]) Delete(ctx context.Context, q *gplus.QueryCond[T], opts ...
 
 // UpdateById 根据 ID 更新,默认零值不更新
 func (b *BaseDao[T]) UpdateById(ctx context.Context, entity *T, opts ...gplus.OptionFunc) error {
-	opts = append(opts, gplus.Omit("create_time"))
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.UpdateById[T](ctx, entity, opts...).Error
 }
 
 // UpdateZeroById 根据 ID 零值更新
 func (b *BaseDao[T]) UpdateZeroById(ctx context.Context, entity *T, opts ...gplus.OptionFunc) error {
-	opts = append(opts, gplus.Omit("create_time"))
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.UpdateZeroById[T](ctx, entity, opts...).Error
 }
 
+// UpdateBatchById 在同一个事务中逐条根据 ID 更新,默认零值不更新,任一记录更新失败时全部回滚,
+// ctx中已有绑定数据源的事务时加入该事务
+func (b *BaseDao[T]) UpdateBatchById(ctx context.Context, entities []*T, opts ...gplus.OptionFunc) error {
+	return Transaction(
+		ctx, func(ctx context.Context) error {
+			for _, entity := range entities {
+				if err := b.UpdateById(ctx, entity, opts...); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, WithTxDataSource(b.dataSourceName()),
+	)
+}
+
+// UpdateByIdWithRetry 从主库读取最新记录并执行mutate后按版本号零值更新,版本号冲突时重新读取并重试,
+// 最多重试retries次,实体需有 gbase:"version" 标签的版本号字段,记录不存在时返回gorm.ErrRecordNotFound。
+// ctx中已有该数据源的事务时,可重复读隔离级别下重新读取的仍是事务开始时的快照,因此不重试,
+// 冲突时直接返回ErrOptimisticLockConflict,由调用方回滚后重试整个事务
+func (b *BaseDao[T]) UpdateByIdWithRetry(
+	ctx context.Context, id any, retries int, mutate func(entity *T) error, opts ...gplus.OptionFunc) (*T, error) {
+	if txFromContext(ctx, b.dataSourceName()) != nil {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		entity, err := b.SelectById(WithPrimary(ctx), id, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			return nil, gorm.ErrRecordNotFound
+		}
+		if err = mutate(entity); err != nil {
+			return nil, err
+		}
+		err = b.UpdateZeroById(ctx, entity, opts...)
+		if err == nil {
+			return entity, nil
+		}
+		if !errors.Is(err, ErrOptimisticLockConflict) || attempt >= retries {
+			return nil, err
+		}
+	}
+}
+
 // Update 根据 Map 更新
 func (b *BaseDao[T]) Update(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) error {
-	opts = append(opts, gplus.Omit("create_time"))
+	opts, err := b.withDb(ctx, opts)
+	if err != nil {
+		return err
+	}
 	return gplus.Update[T](ctx, q, opts...).Error
 }
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SUPERDBFMP/gorm-plus-enhanced/gplus"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestInsertOrUpdate(t *testing.T) {
+	db := openTestDB(t, auditConfig, &auditRecord{})
+	dao := NewBaseDao[auditRecord]()
+	ctx := context.Background()
+	record := &auditRecord{Name: "a"}
+	if err := dao.Insert(WithOperator(ctx, int64(1)), record); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.InsertOrUpdate(WithOperator(ctx, int64(2)), &auditRecord{Id: record.Id, Name: "b"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var loaded auditRecord
+	if err := db.First(&loaded, record.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "b" || loaded.CreateBy != 1 || loaded.UpdateBy != 2 {
+		t.Fatalf("record = %+v, want name and updater updated, creator kept", loaded)
+	}
+
+	// MySQL下生成ON DUPLICATE KEY UPDATE子句,不更新创建时间与创建人
+	mysqlDb, err := gorm.Open(
+		mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{
+			DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Discard,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = registerAudit(mysqlDb, auditConfig); err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	if err = mysqlDb.Callback().Create().After("gorm:create").Register(
+		"test:capture", func(d *gorm.DB) {
+			statements = append(statements, d.Statement.SQL.String())
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	entities := []*auditRecord{{Id: 1, Name: "c"}, {Id: 2, Name: "d"}}
+	if err = dao.InsertOrUpdate(ctx, &auditRecord{Id: 1, Name: "c"}, []string{"name"}, gplus.Db(mysqlDb)); err != nil {
+		t.Fatal(err)
+	}
+	if err = dao.InsertOrUpdateBatch(ctx, entities, nil, gplus.Db(mysqlDb)); err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("statements = %q, want 2", statements)
+	}
+	onDuplicate := "ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`update_time`=VALUES(`update_time`)"
+	if !strings.HasSuffix(statements[0], onDuplicate) {
+		t.Fatalf("sql = %s, want name and update_time updated on duplicate key", statements[0])
+	}
+	for _, column := range []string{"`name`=VALUES(`name`)", "`update_by`=VALUES(`update_by`)", "`deleted`=VALUES(`deleted`)"} {
+		if !strings.Contains(statements[1], column) {
+			t.Fatalf("sql = %s, want %s updated on duplicate key", statements[1], column)
+		}
+	}
+	for _, column := range []string{"`create_time`=", "`create_by`=", "`id`="} {
+		if strings.Contains(statements[1], column) {
+			t.Fatalf("sql = %s, want %s not updated on duplicate key", statements[1], column)
+		}
+	}
+}
+
+func TestUpdateBatchById(t *testing.T) {
+	db := openTestDB(t, nil, &versionRecord{})
+	dao := NewBaseDao[versionRecord]()
+	ctx := context.Background()
+	first, second := &versionRecord{Name: "a", Version: 1}, &versionRecord{Name: "b", Version: 1}
+	if err := dao.InsertBatch(ctx, []*versionRecord{first, second}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二条记录的版本号已过期,第一条记录的更新一起回滚
+	err := dao.UpdateBatchById(
+		ctx, []*versionRecord{{Id: first.Id, Name: "a2", Version: 1}, {Id: second.Id, Name: "b2", Version: 5}},
+	)
+	if !errors.Is(err, ErrOptimisticLockConflict) {
+		t.Fatalf("err = %v, want ErrOptimisticLockConflict", err)
+	}
+	if loaded := loadVersionRecord(t, db, first.Id); loaded.Name != "a" || loaded.Version != 1 {
+		t.Fatalf("record = %+v, want update rolled back", loaded)
+	}
+
+	if err = dao.UpdateBatchById(
+		ctx, []*versionRecord{{Id: first.Id, Name: "a2", Version: 1}, {Id: second.Id, Name: "b2", Version: 1}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadVersionRecord(t, db, second.Id); loaded.Name != "b2" || loaded.Version != 2 {
+		t.Fatalf("record = %+v, want updated", loaded)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	openTestDB(t, nil, &snowflakeRecord{})
+	dao := NewBaseDaoWithComparable[snowflakeRecord, int64]()
+	ctx := context.Background()
+	// 包含非正数的主键,第一批不带主键下限
+	want := []int64{-2, -1, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	records := make([]*snowflakeRecord, 0, len(want))
+	for _, id := range want {
+		records = append(records, &snowflakeRecord{Id: id, Name: "r"})
+	}
+	if err := dao.InsertBatch(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int64
+	err := dao.Iterate(
+		ctx, nil, 5, func(records []*snowflakeRecord) error {
+			for _, record := range records {
+				got = append(got, record.Id)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ids = %v, want %v", got, want)
+	}
+
+	// 第一个fn返回错误后不再查询后续批次
+	errBoom := errors.New("boom")
+	var calls atomic.Int32
+	err = dao.IterateConcurrently(
+		ctx, nil, 1, 2, func(records []*snowflakeRecord) error {
+			calls.Add(1)
+			if records[0].Id == want[0] {
+				return errBoom
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+	)
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("err = %v, want first worker error", err)
+	}
+	if n := calls.Load(); n >= int32(len(want)) {
+		t.Fatalf("calls = %d, want iteration cancelled before all %d batches", n, len(want))
+	}
+}
@@ -0,0 +1,410 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/cache"
+	"github.com/SUPERDBFMP/go-base/glog"
+
+	"github.com/SUPERDBFMP/gorm-plus-enhanced/gplus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// defaultNullTTL 记录不存在时缓存空结果的默认过期时间
+const defaultNullTTL = time.Minute
+
+// CacheOption CachedDao选项
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	namespace string
+	nullTTL   time.Duration
+	cacheOpts []cache.Option
+}
+
+// WithCacheNamespace 指定缓存的命名空间,默认为 dao:数据源:实体类型,如 dao:default:model.User
+func WithCacheNamespace(namespace string) CacheOption {
+	return func(o *cacheOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithNullTTL 指定记录不存在时缓存空结果的过期时间,防止查询不存在的主键穿透到数据库,默认1分钟,为0时不缓存空结果
+func WithNullTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.nullTTL = ttl
+	}
+}
+
+// WithCacheOptions 指定缓存选项,如Redis实例、过期时间与本地缓存
+func WithCacheOptions(opts ...cache.Option) CacheOption {
+	return func(o *cacheOptions) {
+		o.cacheOpts = append(o.cacheOpts, opts...)
+	}
+}
+
+// CachedDao 按主键缓存的BaseDao,SelectById先读缓存,不存在时查询数据库并写入缓存,
+// 插入、更新与删除成功后删除对应主键的缓存,ctx中有事务时在事务提交后删除。
+// 按条件更新与删除在执行前从主库查询满足条件的主键、冲突时更新的插入在执行前从主库查询唯一索引冲突的主键,
+// 并在成功后删除,其他查询不使用缓存
+type CachedDao[T any] struct {
+	*BaseDao[T]
+	cache   *cache.Cache[*T]
+	nullTTL time.Duration
+}
+
+// NewCachedDao 创建按主键缓存的dao,dao为空时使用默认数据源
+func NewCachedDao[T any](dao *BaseDao[T], opts ...CacheOption) *CachedDao[T] {
+	if dao == nil {
+		dao = NewBaseDao[T]()
+	}
+	options := cacheOptions{nullTTL: defaultNullTTL}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.namespace == "" {
+		options.namespace = fmt.Sprintf("dao:%s:%s", dao.dataSourceName(), reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return &CachedDao[T]{
+		BaseDao: dao,
+		cache:   cache.New[*T](options.namespace, options.cacheOpts...),
+		nullTTL: options.nullTTL,
+	}
+}
+
+// Cache 返回使用的缓存
+func (d *CachedDao[T]) Cache() *cache.Cache[*T] {
+	return d.cache
+}
+
+// Evict 删除指定主键的缓存,用于绕过CachedDao修改数据后手动删除
+func (d *CachedDao[T]) Evict(ctx context.Context, ids ...any) error {
+	return d.cache.Delete(ctx, idKeys(ids)...)
+}
+
+// cacheable 是否可以使用缓存,指定了查询选项、在事务中或强制读主库时直接查询数据库
+func (d *CachedDao[T]) cacheable(ctx context.Context, opts []gplus.OptionFunc) bool {
+	return len(opts) == 0 && txFromContext(ctx, d.dataSourceName()) == nil && !isForcePrimary(ctx)
+}
+
+// SelectById 根据 ID 查询单条记录,先读缓存,记录不存在时返回nil并缓存空结果,
+// 返回的是缓存值的浅拷贝,修改返回值不影响缓存
+func (d *CachedDao[T]) SelectById(ctx context.Context, id any, opts ...gplus.OptionFunc) (*T, error) {
+	if !d.cacheable(ctx, opts) {
+		return d.BaseDao.SelectById(ctx, id, opts...)
+	}
+	entity, err := d.cache.GetOrLoadWithTTL(
+		ctx, fmt.Sprint(id), func(ctx context.Context) (*T, time.Duration, error) {
+			// 从主库加载,避免写入后立即读取时从延迟的副本读到旧值并写入缓存
+			entity, err := d.BaseDao.SelectById(WithPrimary(ctx), id)
+			if err != nil || entity != nil {
+				return entity, d.cache.TTL(), err
+			}
+			if d.nullTTL <= 0 {
+				return nil, -1, nil
+			}
+			return nil, d.nullTTL, nil
+		},
+	)
+	if err != nil || entity == nil {
+		return nil, err
+	}
+	copied := *entity
+	return &copied, nil
+}
+
+// evict 删除缓存,ctx中有该数据源的事务时在事务提交后删除,删除失败时只记录日志,缓存在过期后恢复一致
+func (d *CachedDao[T]) evict(ctx context.Context, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	evict := func(ctx context.Context) {
+		if err := d.cache.Delete(ctx, keys...); err != nil {
+			glog.Errorf(ctx, "删除缓存%v失败:%v", keys, err)
+		}
+	}
+	if tc := txFromContext(ctx, d.dataSourceName()); tc != nil {
+		tc.afterCommit = append(tc.afterCommit, evict)
+		return
+	}
+	evict(ctx)
+}
+
+// idKeys 将主键转换为缓存key,切片或数组中的每个元素为一个主键
+func idKeys(ids []any) []string {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		value := reflect.ValueOf(id)
+		if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+			for i := 0; i < value.Len(); i++ {
+				keys = append(keys, fmt.Sprint(value.Index(i).Interface()))
+			}
+			continue
+		}
+		keys = append(keys, fmt.Sprint(id))
+	}
+	return keys
+}
+
+// entityKeys 返回实体主键对应的缓存key,主键为零值的实体跳过
+func (d *CachedDao[T]) entityKeys(ctx context.Context, entities []*T) ([]string, error) {
+	s, err := d.parseSchema(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	field := s.PrioritizedPrimaryField
+	if field == nil {
+		return nil, fmt.Errorf("%s: 缓存的实体必须有唯一的主键", s.Name)
+	}
+	keys := make([]string, 0, len(entities))
+	for _, entity := range entities {
+		if entity == nil {
+			continue
+		}
+		if id, isZero := field.ValueOf(ctx, reflect.ValueOf(entity).Elem()); !isZero {
+			keys = append(keys, fmt.Sprint(id))
+		}
+	}
+	return keys, nil
+}
+
+// evictEntities 写入成功后删除实体的缓存
+func (d *CachedDao[T]) evictEntities(ctx context.Context, err error, entities ...*T) error {
+	if err != nil {
+		return err
+	}
+	keys, err := d.entityKeys(ctx, entities)
+	if err != nil {
+		return err
+	}
+	d.evict(ctx, keys)
+	return nil
+}
+
+// conditionKeys 从主库查询满足条件的记录的主键,在按条件更新与删除之前调用
+func (d *CachedDao[T]) conditionKeys(
+	ctx context.Context, q *gplus.QueryCond[T], opts []gplus.OptionFunc) ([]string, error) {
+	s, err := d.parseSchema(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if s.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("%s: 缓存的实体必须有唯一的主键", s.Name)
+	}
+	selectOpts := append(opts[:len(opts):len(opts)], gplus.Select(s.PrioritizedPrimaryField.DBName))
+	entities, err := d.BaseDao.SelectList(WithPrimary(ctx), q, selectOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return d.entityKeys(ctx, entities)
+}
+
+// upsertKeys 实体主键与从主库查询的唯一索引冲突的记录的主键,在插入或更新之前调用,
+// 唯一索引冲突时更新的是主键不同的已有记录,包括已逻辑删除的记录
+func (d *CachedDao[T]) upsertKeys(ctx context.Context, entities []*T, opts []gplus.OptionFunc) ([]string, error) {
+	keys, err := d.entityKeys(ctx, entities)
+	if err != nil {
+		return nil, err
+	}
+	var db *gorm.DB
+	if _, err = d.withClauses(
+		ctx, opts, func(d *gorm.DB) *gorm.DB {
+			db = d
+			return d
+		},
+	); err != nil {
+		return nil, err
+	}
+	s, err := d.parseSchema(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	uniques := uniqueFields(s)
+	if len(uniques) == 0 {
+		return keys, nil
+	}
+	conditions := make([]clause.Expression, 0, len(entities)*len(uniques))
+	for _, entity := range entities {
+		if entity == nil {
+			continue
+		}
+		value := reflect.ValueOf(entity).Elem()
+		for _, fields := range uniques {
+			equals := make([]clause.Expression, 0, len(fields))
+			for _, field := range fields {
+				v, _ := field.ValueOf(ctx, value)
+				equals = append(equals, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: v})
+			}
+			conditions = append(conditions, clause.And(equals...))
+		}
+	}
+	if len(conditions) == 0 {
+		return keys, nil
+	}
+	var existing []*T
+	if err = db.Session(&gorm.Session{NewDB: true, Context: WithPrimary(ctx)}).Unscoped().
+		Select(s.PrioritizedPrimaryField.DBName).Where(clause.Or(conditions...)).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	existingKeys, err := d.entityKeys(ctx, existing)
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, existingKeys...), nil
+}
+
+// uniqueFields 主键以外的唯一约束,每个元素为一个唯一列或联合唯一索引的列
+func uniqueFields(s *schema.Schema) [][]*schema.Field {
+	var uniques [][]*schema.Field
+	for _, field := range s.Fields {
+		if field.Unique && !field.PrimaryKey {
+			uniques = append(uniques, []*schema.Field{field})
+		}
+	}
+	for _, index := range s.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		fields := make([]*schema.Field, 0, len(index.Fields))
+		for _, option := range index.Fields {
+			if option.Field != nil {
+				fields = append(fields, option.Field)
+			}
+		}
+		if len(fields) > 0 {
+			uniques = append(uniques, fields)
+		}
+	}
+	return uniques
+}
+
+// upsertEntities 从主库查询可能被更新的记录的主键,插入或更新成功后删除这些主键的缓存
+func (d *CachedDao[T]) upsertEntities(
+	ctx context.Context, entities []*T, opts []gplus.OptionFunc, upsert func() error) error {
+	keys, err := d.upsertKeys(ctx, entities, opts)
+	if err != nil {
+		return err
+	}
+	if err = upsert(); err != nil {
+		return err
+	}
+	d.evict(ctx, keys)
+	return nil
+}
+
+//---------------------------------------------------插入------------------------------------------------------//
+
+// Insert 插入一条记录,删除该主键缓存的空结果
+func (d *CachedDao[T]) Insert(ctx context.Context, entity *T, opts ...gplus.OptionFunc) error {
+	return d.evictEntities(ctx, d.BaseDao.Insert(ctx, entity, opts...), entity)
+}
+
+// InsertBatch 批量插入多条记录
+func (d *CachedDao[T]) InsertBatch(ctx context.Context, entities []*T, opts ...gplus.OptionFunc) error {
+	return d.evictEntities(ctx, d.BaseDao.InsertBatch(ctx, entities, opts...), entities...)
+}
+
+// InsertBatchSize 批量插入多条记录
+func (d *CachedDao[T]) InsertBatchSize(
+	ctx context.Context, entities []*T, batchSize int, opts ...gplus.OptionFunc) error {
+	return d.evictEntities(ctx, d.BaseDao.InsertBatchSize(ctx, entities, batchSize, opts...), entities...)
+}
+
+// InsertOrUpdate 插入一条记录,冲突时更新,插入前从主库查询与实体的唯一索引冲突的记录,
+// 成功后删除实体主键与这些记录主键的缓存
+func (d *CachedDao[T]) InsertOrUpdate(ctx context.Context, entity *T, columns []string, opts ...gplus.OptionFunc) error {
+	return d.upsertEntities(
+		ctx, []*T{entity}, opts, func() error {
+			return d.BaseDao.InsertOrUpdate(ctx, entity, columns, opts...)
+		},
+	)
+}
+
+// InsertOrUpdateBatch 批量插入多条记录,冲突时更新,删除缓存的规则与InsertOrUpdate相同
+func (d *CachedDao[T]) InsertOrUpdateBatch(
+	ctx context.Context, entities []*T, columns []string, opts ...gplus.OptionFunc) error {
+	return d.upsertEntities(
+		ctx, entities, opts, func() error {
+			return d.BaseDao.InsertOrUpdateBatch(ctx, entities, columns, opts...)
+		},
+	)
+}
+
+//---------------------------------------------------删除------------------------------------------------------//
+
+// DeleteById 根据 ID 删除记录并删除缓存
+func (d *CachedDao[T]) DeleteById(ctx context.Context, id any, opts ...gplus.OptionFunc) error {
+	if err := d.BaseDao.DeleteById(ctx, id, opts...); err != nil {
+		return err
+	}
+	d.evict(ctx, idKeys([]any{id}))
+	return nil
+}
+
+// DeleteByIds 根据 ID 批量删除记录并删除缓存
+func (d *CachedDao[T]) DeleteByIds(ctx context.Context, ids any, opts ...gplus.OptionFunc) error {
+	if err := d.BaseDao.DeleteByIds(ctx, ids, opts...); err != nil {
+		return err
+	}
+	d.evict(ctx, idKeys([]any{ids}))
+	return nil
+}
+
+// Delete 根据条件删除记录,删除前从主库查询满足条件的主键,删除成功后删除这些主键的缓存
+func (d *CachedDao[T]) Delete(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) error {
+	keys, err := d.conditionKeys(ctx, q, opts)
+	if err != nil {
+		return err
+	}
+	if err = d.BaseDao.Delete(ctx, q, opts...); err != nil {
+		return err
+	}
+	d.evict(ctx, keys)
+	return nil
+}
+
+//---------------------------------------------------更新------------------------------------------------------//
+
+// UpdateById 根据 ID 更新并删除缓存,默认零值不更新
+func (d *CachedDao[T]) UpdateById(ctx context.Context, entity *T, opts ...gplus.OptionFunc) error {
+	return d.evictEntities(ctx, d.BaseDao.UpdateById(ctx, entity, opts...), entity)
+}
+
+// UpdateZeroById 根据 ID 零值更新并删除缓存
+func (d *CachedDao[T]) UpdateZeroById(ctx context.Context, entity *T, opts ...gplus.OptionFunc) error {
+	return d.evictEntities(ctx, d.BaseDao.UpdateZeroById(ctx, entity, opts...), entity)
+}
+
+// UpdateBatchById 在同一个事务中逐条根据 ID 更新,事务提交后删除缓存
+func (d *CachedDao[T]) UpdateBatchById(ctx context.Context, entities []*T, opts ...gplus.OptionFunc) error {
+	return d.evictEntities(ctx, d.BaseDao.UpdateBatchById(ctx, entities, opts...), entities...)
+}
+
+// UpdateByIdWithRetry 从主库读取最新记录并按版本号更新,更新成功后删除缓存,规则与BaseDao.UpdateByIdWithRetry相同
+func (d *CachedDao[T]) UpdateByIdWithRetry(
+	ctx context.Context, id any, retries int, mutate func(entity *T) error, opts ...gplus.OptionFunc) (*T, error) {
+	entity, err := d.BaseDao.UpdateByIdWithRetry(ctx, id, retries, mutate, opts...)
+	if err != nil {
+		return nil, err
+	}
+	d.evict(ctx, idKeys([]any{id}))
+	return entity, nil
+}
+
+// Update 根据条件更新,更新前从主库查询满足条件的主键,更新成功后删除这些主键的缓存
+func (d *CachedDao[T]) Update(ctx context.Context, q *gplus.QueryCond[T], opts ...gplus.OptionFunc) error {
+	keys, err := d.conditionKeys(ctx, q, opts)
+	if err != nil {
+		return err
+	}
+	if err = d.BaseDao.Update(ctx, q, opts...); err != nil {
+		return err
+	}
+	d.evict(ctx, keys)
+	return nil
+}
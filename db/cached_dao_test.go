@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/cache"
+	"github.com/SUPERDBFMP/go-base/config"
+	"github.com/SUPERDBFMP/go-base/redis"
+
+	"github.com/SUPERDBFMP/gorm-plus-enhanced/gplus"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// openTestCache 启动miniredis作为默认Redis实例,测试结束后关闭
+func openTestCache(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redis.InitNamed(context.Background(), config.DefaultRedis, &config.RedisConfig{ServerAddress: mr.Addr()})
+	t.Cleanup(func() { _ = redis.CloseRedis(context.Background()) })
+	return mr
+}
+
+func TestCachedDaoSelectById(t *testing.T) {
+	openTestDB(t, nil, &snowflakeRecord{})
+	mr := openTestCache(t)
+	ctx := context.Background()
+	dao := NewCachedDao[snowflakeRecord](nil, WithNullTTL(10*time.Second), WithCacheOptions(cache.WithJitter(0)))
+	key := dao.Cache().Key("100")
+
+	// 记录不存在时按nullTTL缓存空结果
+	if entity, err := dao.SelectById(ctx, int64(100)); err != nil || entity != nil {
+		t.Fatalf("entity = %v, err = %v, want nil", entity, err)
+	}
+	if ttl := mr.TTL(key); ttl != 10*time.Second {
+		t.Fatalf("null result ttl = %v, want 10s", ttl)
+	}
+
+	// 插入后删除空结果,再次查询时按默认过期时间缓存
+	if err := dao.Insert(ctx, &snowflakeRecord{Id: 100, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(key) {
+		t.Fatal("null result should be evicted after insert")
+	}
+	entity, err := dao.SelectById(ctx, int64(100))
+	if err != nil || entity == nil || entity.Name != "a" {
+		t.Fatalf("entity = %v, err = %v, want loaded record", entity, err)
+	}
+	if ttl := mr.TTL(key); ttl != dao.Cache().TTL() {
+		t.Fatalf("ttl = %v, want %v", ttl, dao.Cache().TTL())
+	}
+
+	// nullTTL为0时不缓存空结果
+	noNull := NewCachedDao[snowflakeRecord](nil, WithCacheNamespace("no-null"), WithNullTTL(0))
+	if _, err = noNull.SelectById(ctx, int64(101)); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(noNull.Cache().Key("101")) {
+		t.Fatal("null result should not be cached when nullTTL is 0")
+	}
+}
+
+func TestCachedDaoEviction(t *testing.T) {
+	openTestDB(t, nil, &snowflakeRecord{})
+	mr := openTestCache(t)
+	ctx := context.Background()
+	dao := NewCachedDao[snowflakeRecord](nil)
+	records := []*snowflakeRecord{{Id: 1, Name: "x"}, {Id: 2, Name: "x"}, {Id: 3, Name: "y"}}
+	if err := dao.InsertBatch(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	// load 查询记录写入缓存
+	load := func(t *testing.T, ids ...int64) {
+		t.Helper()
+		for _, id := range ids {
+			if _, err := dao.SelectById(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+			if !mr.Exists(dao.Cache().Key(fmt.Sprint(id))) {
+				t.Fatalf("record %d should be cached", id)
+			}
+		}
+	}
+	cached := func(id int64) bool {
+		return mr.Exists(dao.Cache().Key(fmt.Sprint(id)))
+	}
+
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{"UpdateById", func() error { return dao.UpdateById(ctx, &snowflakeRecord{Id: 1, Name: "a"}) }},
+		{"UpdateZeroById", func() error { return dao.UpdateZeroById(ctx, &snowflakeRecord{Id: 1, Name: "x"}) }},
+		{"UpdateBatchById", func() error { return dao.UpdateBatchById(ctx, []*snowflakeRecord{{Id: 1, Name: "x"}}) }},
+		{"InsertOrUpdate", func() error { return dao.InsertOrUpdate(ctx, &snowflakeRecord{Id: 1, Name: "x"}, nil) }},
+		{
+			"InsertOrUpdateBatch", func() error {
+				return dao.InsertOrUpdateBatch(ctx, []*snowflakeRecord{{Id: 1, Name: "x"}}, []string{"name"})
+			},
+		},
+		{
+			"UpdateByIdWithRetry", func() error {
+				_, err := dao.UpdateByIdWithRetry(
+					ctx, int64(1), 0, func(entity *snowflakeRecord) error {
+						entity.Name = "x"
+						return nil
+					},
+				)
+				return err
+			},
+		},
+	}
+	for _, w := range writes {
+		load(t, 1)
+		if err := w.write(); err != nil {
+			t.Fatalf("%s: %v", w.name, err)
+		}
+		if cached(1) {
+			t.Fatalf("%s should evict the cache", w.name)
+		}
+	}
+
+	// 按条件更新与删除时删除满足条件的记录的缓存
+	load(t, 1, 2, 3)
+	q, model := gplus.NewQuery[snowflakeRecord]()
+	q.Eq(&model.Name, "x").Set(&model.Name, "z")
+	if err := dao.Update(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	if cached(1) || cached(2) || !cached(3) {
+		t.Fatal("Update should evict only the matched records")
+	}
+	load(t, 1, 2)
+	q, model = gplus.NewQuery[snowflakeRecord]()
+	q.Eq(&model.Name, "z")
+	if err := dao.Delete(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	if cached(1) || cached(2) || !cached(3) {
+		t.Fatal("Delete should evict only the matched records")
+	}
+	if entity, _ := dao.SelectById(ctx, int64(1)); entity != nil {
+		t.Fatal("record 1 should be deleted")
+	}
+
+	if err := dao.Insert(ctx, &snowflakeRecord{Id: 4, Name: "w"}); err != nil {
+		t.Fatal(err)
+	}
+	load(t, 3, 4)
+	if err := dao.DeleteById(ctx, int64(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.DeleteByIds(ctx, []int64{4}); err != nil {
+		t.Fatal(err)
+	}
+	if cached(3) || cached(4) {
+		t.Fatal("DeleteById and DeleteByIds should evict the cache")
+	}
+}
+
+func TestCachedDaoTransaction(t *testing.T) {
+	openTestDB(t, nil, &snowflakeRecord{})
+	mr := openTestCache(t)
+	ctx := context.Background()
+	dao := NewCachedDao[snowflakeRecord](nil)
+	if err := dao.Insert(ctx, &snowflakeRecord{Id: 1, Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	key := dao.Cache().Key("1")
+	if _, err := dao.SelectById(ctx, int64(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 事务回滚时不删除缓存
+	errRollback := errors.New("rollback")
+	err := Transaction(
+		ctx, func(ctx context.Context) error {
+			if err := dao.UpdateById(ctx, &snowflakeRecord{Id: 1, Name: "b"}); err != nil {
+				return err
+			}
+			return errRollback
+		},
+	)
+	if !errors.Is(err, errRollback) || !mr.Exists(key) {
+		t.Fatalf("err = %v, want cache kept after rollback", err)
+	}
+
+	// 事务提交后删除缓存
+	err = Transaction(
+		ctx, func(ctx context.Context) error {
+			if err := dao.UpdateById(ctx, &snowflakeRecord{Id: 1, Name: "c"}); err != nil {
+				return err
+			}
+			if !mr.Exists(key) {
+				t.Error("cache should be evicted after commit, not before")
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(key) {
+		t.Fatal("cache should be evicted after commit")
+	}
+	if entity, err := dao.SelectById(ctx, int64(1)); err != nil || entity.Name != "c" {
+		t.Fatalf("entity = %v, err = %v, want committed value", entity, err)
+	}
+}
+
+type uniqueRecord struct {
+	Id     int64  `gorm:"primaryKey"`
+	Email  string `gorm:"unique"`
+	Tenant int64  `gorm:"uniqueIndex:idx_tenant_code"`
+	Code   string `gorm:"uniqueIndex:idx_tenant_code"`
+	Name   string
+}
+
+func TestCachedDaoUpsertUniqueConflict(t *testing.T) {
+	db := openTestDB(t, nil, &uniqueRecord{})
+	mr := openTestCache(t)
+	ctx := context.Background()
+	dao := NewCachedDao[uniqueRecord](nil)
+	records := []*uniqueRecord{
+		{Id: 1, Email: "a", Tenant: 1, Code: "x", Name: "a"},
+		{Id: 2, Email: "b", Tenant: 1, Code: "y", Name: "b"},
+	}
+	if err := dao.InsertBatch(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	// load 查询记录写入缓存
+	load := func(t *testing.T, ids ...int64) {
+		t.Helper()
+		for _, id := range ids {
+			if _, err := dao.SelectById(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cached := func(id int64) bool {
+		return mr.Exists(dao.Cache().Key(fmt.Sprint(id)))
+	}
+
+	// 唯一列冲突时更新的是主键为1的记录
+	load(t, 1, 2, 3)
+	if err := dao.InsertOrUpdate(ctx, &uniqueRecord{Id: 3, Email: "a", Tenant: 2, Code: "z", Name: "c"}, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+	if cached(1) || cached(3) || !cached(2) {
+		t.Fatal("InsertOrUpdate should evict the conflicting record and the entity key only")
+	}
+	if entity, err := dao.SelectById(ctx, int64(1)); err != nil || entity.Name != "c" {
+		t.Fatalf("entity = %v, err = %v, want conflicting record updated", entity, err)
+	}
+
+	// 联合唯一索引冲突时更新的是主键为2的记录
+	load(t, 1, 2)
+	err := dao.InsertOrUpdateBatch(
+		ctx, []*uniqueRecord{{Id: 4, Email: "d", Tenant: 1, Code: "y", Name: "d"}}, []string{"name"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached(2) || !cached(1) {
+		t.Fatal("InsertOrUpdateBatch should evict the record conflicting on the composite unique index")
+	}
+	var loaded uniqueRecord
+	if err = db.First(&loaded, 2).Error; err != nil || loaded.Name != "d" {
+		t.Fatalf("record = %+v, err = %v, want updated", loaded, err)
+	}
+}
@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// ErrDataSourceNotFound 指定名称的数据源不存在或未初始化
+var ErrDataSourceNotFound = errors.New("datasource not found")
+
+// dataSource 已连接的命名数据源
+type dataSource struct {
+	db         *gorm.DB
+	resolver   *dbresolver.DBResolver // 读写分离,未配置只读副本时为空
+	collectors []prometheus.Collector // 连接池指标,关闭时注销
+}
+
+var (
+	dataSourceMutex sync.RWMutex
+	dataSources     = make(map[string]*dataSource)
+
+	// openDialector 按连接串创建主库与只读副本的Dialector
+	openDialector = mysql.Open
+)
+
+// Get 获取指定名称的数据源,默认数据源的名称为 config.DefaultDataSource,不存在时返回nil
+func Get(name string) *gorm.DB {
+	dataSourceMutex.RLock()
+	defer dataSourceMutex.RUnlock()
+	if ds, ok := dataSources[name]; ok {
+		return ds.db
+	}
+	return nil
+}
+
+// dataSourceConfigs 需要连接的数据源,mysql配置为默认数据源
+func dataSourceConfigs() map[string]*config.MySqlConfig {
+	configs := make(map[string]*config.MySqlConfig)
+	if config.IsConfigured(config.MySqlDataId) {
+		configs[config.DefaultDataSource] = config.GlobalConf.MySQL
+	}
+	for name, dataSourceConfig := range config.GlobalConf.DataSources {
+		configs[name] = dataSourceConfig
+	}
+	return configs
+}
+
+// sortedNames 按名称排序的数据源,保证初始化与关闭的顺序稳定
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// buildDsn 生成mysql连接串
+func buildDsn(userName, password, host string, port int, dbName string) string {
+	return fmt.Sprintf(
+		"%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", userName, password, host, port, dbName,
+	)
+}
+
+// openDataSource 连接数据源,配置了只读副本时注册读写分离,
+// 失败时关闭已打开的主库与只读副本连接并注销已注册的连接池指标
+func openDataSource(name string, mysqlConfig *config.MySqlConfig) (*dataSource, error) {
+	slowThreshold := time.Duration(mysqlConfig.SlowThreshold) * time.Millisecond
+	gormLogger := newGormLogger()
+	gormLogger.SlowThreshold = slowThreshold
+	gormLogger.LogLevel = parseLogLevel(mysqlConfig.LogLevel)
+	gormLogger.Mode = mysqlConfig.SqlLogMode
+	gormLogger.SampleRate = mysqlConfig.SqlLogSampleRate
+	if len(mysqlConfig.SqlLogRedactColumns) > 0 {
+		gormLogger.RedactColumns = make(map[string]bool, len(mysqlConfig.SqlLogRedactColumns))
+		for _, column := range mysqlConfig.SqlLogRedactColumns {
+			gormLogger.RedactColumns[strings.ToLower(column)] = true
+		}
+	}
+
+	dsn := buildDsn(mysqlConfig.UserName, mysqlConfig.Password, mysqlConfig.Host, mysqlConfig.Port, mysqlConfig.DbName)
+	db, err := gorm.Open(openDialector(dsn), &gorm.Config{Logger: gormLogger})
+	if err != nil {
+		return nil, fmt.Errorf("连接数据库[%s]失败,异常:%w", mysqlConfig.DbName, err)
+	}
+	ds := &dataSource{db: db}
+	if err = ds.setup(name, mysqlConfig, slowThreshold); err != nil {
+		if closeErr := ds.close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		return nil, err
+	}
+	return ds, nil
+}
+
+// setup 检查连接并注册读写分离、连接池、指标与各回调
+func (ds *dataSource) setup(name string, mysqlConfig *config.MySqlConfig, slowThreshold time.Duration) error {
+	db := ds.db
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get sqlDB: %w", err)
+	}
+	if err = sqlDB.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	if len(mysqlConfig.Replicas) > 0 {
+		// 注册失败时也保留resolver,关闭时释放已打开的只读副本
+		if ds.resolver, err = registerReplicas(db, mysqlConfig); err != nil {
+			return err
+		}
+	}
+	ds.configurePool(mysqlConfig)
+	if err = registerMetrics(db, name, slowThreshold); err != nil {
+		return fmt.Errorf("注册SQL指标回调失败: %w", err)
+	}
+	if err = ds.registerStatsCollectors(name); err != nil {
+		return err
+	}
+	if err = setupGlobalIDHook(db); err != nil {
+		return fmt.Errorf("failed to setup global ID hook: %w", err)
+	}
+	if err = registerAudit(db, mysqlConfig); err != nil {
+		return fmt.Errorf("注册审计字段与逻辑删除回调失败: %w", err)
+	}
+	if err = registerOptimisticLock(db); err != nil {
+		return fmt.Errorf("注册乐观锁回调失败: %w", err)
+	}
+	return nil
+}
+
+// registerReplicas 注册只读副本,读请求按策略路由到副本,写请求与事务使用主库,失败时同样返回resolver用于关闭已打开的副本
+func registerReplicas(db *gorm.DB, mysqlConfig *config.MySqlConfig) (*dbresolver.DBResolver, error) {
+	replicas := make([]gorm.Dialector, 0, len(mysqlConfig.Replicas))
+	for _, replica := range mysqlConfig.Replicas {
+		userName, password, port := replica.UserName, replica.Password, replica.Port
+		if userName == "" {
+			userName, password = mysqlConfig.UserName, mysqlConfig.Password
+		}
+		if port == 0 {
+			port = mysqlConfig.Port
+		}
+		replicas = append(replicas, openDialector(buildDsn(userName, password, replica.Host, port, mysqlConfig.DbName)))
+	}
+	var policy dbresolver.Policy = dbresolver.RandomPolicy{}
+	if mysqlConfig.Policy == "round-robin" {
+		policy = dbresolver.StrictRoundRobinPolicy()
+	}
+	resolver := dbresolver.Register(dbresolver.Config{Replicas: replicas, Policy: policy})
+	if err := db.Use(resolver); err != nil {
+		return resolver, fmt.Errorf("注册数据库[%s]只读副本失败: %w", mysqlConfig.DbName, err)
+	}
+	if err := registerForcePrimary(db); err != nil {
+		return resolver, err
+	}
+	return resolver, nil
+}
+
+// configurePool 配置主库与只读副本的连接池
+func (ds *dataSource) configurePool(mysqlConfig *config.MySqlConfig) {
+	if ds.resolver != nil {
+		ds.resolver.SetMaxIdleConns(mysqlConfig.MaxIdle).
+			SetMaxOpenConns(mysqlConfig.MaxConn).
+			SetConnMaxLifetime(time.Duration(mysqlConfig.MaxLife) * time.Minute).
+			SetConnMaxIdleTime(time.Duration(mysqlConfig.MaxIdleTime) * time.Minute)
+	}
+	if sqlDB, err := ds.db.DB(); err == nil {
+		configurePool(sqlDB, mysqlConfig)
+	}
+}
+
+// close 关闭只读副本与主库的连接
+func (ds *dataSource) close() error {
+	ds.unregisterStatsCollectors()
+	sqlDB, err := ds.db.DB()
+	if err != nil {
+		return fmt.Errorf("获取底层数据库连接失败:%w", err)
+	}
+	var errs []error
+	if ds.resolver != nil {
+		errs = append(
+			errs, ds.resolver.Call(
+				func(connPool gorm.ConnPool) error {
+					if replica, ok := connPool.(*sql.DB); ok && replica != sqlDB {
+						return replica.Close()
+					}
+					return nil
+				},
+			),
+		)
+	}
+	errs = append(errs, sqlDB.Close())
+	return errors.Join(errs...)
+}
+
+// forcePrimaryKey context中强制读主库的标记
+type forcePrimaryKey struct{}
+
+// WithPrimary 返回强制读主库的context,用于写后立即读等不能容忍副本延迟的场景
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey{}, true)
+}
+
+// isForcePrimary context是否要求读主库
+func isForcePrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	force, _ := ctx.Value(forcePrimaryKey{}).(bool)
+	return force
+}
+
+// registerForcePrimary 在读写分离之前检查context,带有强制读主库标记时路由到主库,
+// 需在注册dbresolver之后调用,同为Before("*")的回调后注册的先执行
+func registerForcePrimary(db *gorm.DB) error {
+	forcePrimary := func(d *gorm.DB) {
+		if isForcePrimary(d.Statement.Context) {
+			dbresolver.Write.ModifyStatement(d.Statement)
+		}
+	}
+	callback := db.Callback()
+	if err := callback.Query().Before("*").Register("base:force_primary", forcePrimary); err != nil {
+		return err
+	}
+	if err := callback.Row().Before("*").Register("base:force_primary", forcePrimary); err != nil {
+		return err
+	}
+	return callback.Raw().Before("*").Register("base:force_primary", forcePrimary)
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUPERDBFMP/go-base/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// useReplica 将只读副本的连接替换为path指定的sqlite数据库,测试结束后恢复
+func useReplica(t *testing.T, path string) {
+	t.Helper()
+	previous := openDialector
+	openDialector = func(string) gorm.Dialector {
+		return sqlite.Open(path + "?_pragma=busy_timeout(5000)")
+	}
+	t.Cleanup(func() { openDialector = previous })
+}
+
+func TestReadWriteSplit(t *testing.T) {
+	replicaPath := filepath.Join(t.TempDir(), "replica.db")
+	replica := openSqlite(t, replicaPath, &snowflakeRecord{})
+	if err := replica.Create(&snowflakeRecord{Id: 1, Name: "replica"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	useReplica(t, replicaPath)
+	openTestDB(t, &config.MySqlConfig{Replicas: []*config.MySqlReplicaConfig{{Host: "replica"}}}, &snowflakeRecord{})
+	dao := NewBaseDao[snowflakeRecord]()
+	ctx := context.Background()
+	if err := dao.Insert(ctx, &snowflakeRecord{Id: 1, Name: "primary"}); err != nil {
+		t.Fatal(err)
+	}
+	// selectName 查询记录1的名称,区分读取的是主库还是副本
+	selectName := func(t *testing.T, ctx context.Context) string {
+		t.Helper()
+		entity, err := dao.SelectById(ctx, int64(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entity.Name
+	}
+
+	if name := selectName(t, ctx); name != "replica" {
+		t.Fatalf("name = %s, want read from replica", name)
+	}
+	if name := selectName(t, WithPrimary(ctx)); name != "primary" {
+		t.Fatalf("name = %s, want read from primary with WithPrimary", name)
+	}
+	err := Transaction(
+		ctx, func(ctx context.Context) error {
+			if name := selectName(t, ctx); name != "primary" {
+				t.Errorf("name = %s, want read from primary in transaction", name)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNamedDataSource(t *testing.T) {
+	primary := openTestDB(t, nil, &snowflakeRecord{})
+	orders := openNamedTestDB(t, "orders", nil, &snowflakeRecord{})
+	if Get(config.DefaultDataSource) != primary || Get("orders") != orders || Get("missing") != nil {
+		t.Fatal("Get should return the data source registered under the name")
+	}
+
+	ctx := context.Background()
+	dao := NewBaseDao[snowflakeRecord](WithDataSource("orders"))
+	if err := dao.Insert(ctx, &snowflakeRecord{Id: 1, Name: "order"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.First(&snowflakeRecord{}, 1).Error; err != nil {
+		t.Fatalf("err = %v, want record written to the bound data source", err)
+	}
+	if err := primary.First(&snowflakeRecord{}, 1).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("err = %v, want default data source untouched", err)
+	}
+	if entity, err := dao.SelectById(ctx, int64(1)); err != nil || entity.Name != "order" {
+		t.Fatalf("entity = %v, err = %v, want read from the bound data source", entity, err)
+	}
+
+	// 事务绑定到数据源,只对同一数据源的Dao生效
+	err := Transaction(
+		ctx, func(ctx context.Context) error {
+			if err := dao.Insert(ctx, &snowflakeRecord{Id: 2, Name: "order"}); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		}, WithTxDataSource("orders"),
+	)
+	if err == nil {
+		t.Fatal("want rollback error")
+	}
+	if err = orders.First(&snowflakeRecord{}, 2).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("err = %v, want insert rolled back with the orders transaction", err)
+	}
+
+	missing := NewBaseDao[snowflakeRecord](WithDataSource("missing"))
+	if _, err = missing.SelectById(ctx, int64(1)); !errors.Is(err, ErrDataSourceNotFound) {
+		t.Fatalf("err = %v, want ErrDataSourceNotFound", err)
+	}
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/SUPERDBFMP/go-base/config"
+
+	"github.com/SUPERDBFMP/gorm-plus-enhanced/gplus"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSqlite 打开path指定的sqlite数据库并创建models的表
+func openSqlite(t *testing.T, path string, models ...any) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(path+"?_pragma=busy_timeout(5000)"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// openTestDB 打开临时的sqlite数据库,注册与mysql数据源相同的回调并作为默认数据源,测试结束后恢复
+func openTestDB(t *testing.T, mysqlConfig *config.MySqlConfig, models ...any) *gorm.DB {
+	t.Helper()
+	return openNamedTestDB(t, config.DefaultDataSource, mysqlConfig, models...)
+}
+
+// openNamedTestDB 打开临时的sqlite数据库作为name数据源,默认数据源替换原有的全部数据源,其他数据源追加到已有的数据源中
+func openNamedTestDB(t *testing.T, name string, mysqlConfig *config.MySqlConfig, models ...any) *gorm.DB {
+	t.Helper()
+	if mysqlConfig == nil {
+		mysqlConfig = &config.MySqlConfig{}
+	}
+	db := openSqlite(t, filepath.Join(t.TempDir(), name+".db"), models...)
+	ds := &dataSource{db: db}
+	if err := ds.setup(name, mysqlConfig, 0); err != nil {
+		_ = ds.close()
+		t.Fatal(err)
+	}
+	dataSourceMutex.Lock()
+	previous := dataSources
+	if name == config.DefaultDataSource {
+		dataSources = map[string]*dataSource{name: ds}
+	} else {
+		dataSources = make(map[string]*dataSource, len(previous)+1)
+		for n, s := range previous {
+			dataSources[n] = s
+		}
+		dataSources[name] = ds
+	}
+	dataSourceMutex.Unlock()
+	if name == config.DefaultDataSource {
+		gplus.Init(db)
+	}
+	t.Cleanup(
+		func() {
+			dataSourceMutex.Lock()
+			dataSources = previous
+			dataSourceMutex.Unlock()
+			_ = ds.close()
+		},
+	)
+	return db
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/SUPERDBFMP/go-base/idgen"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 主键的ID策略,通过主键字段的标签 gbase:"id=snowflake" 指定
+const (
+	IDStrategySnowflake = "snowflake" // 雪花ID,用于int64、uint64与字符串主键,int64与uint64主键的默认策略
+	IDStrategyUUID      = "uuid"      // UUIDv7,用于字符串主键,字符串主键的默认策略
+	IDStrategyAuto      = "auto"      // 数据库自增,其他类型主键的默认策略
+	IDStrategyNone      = "none"      // 不生成ID,由调用方设置
+)
+
+// IDAssigner 实体自行设置主键,实现后全局ID钩子不再按ID策略为该实体生成ID
+type IDAssigner interface {
+	AssignID(ctx context.Context) error
+}
+
+// parseTag 解析gbase标签,格式为 key=value;key,如 id=uuid
+func parseTag(tag string) map[string]string {
+	settings := make(map[string]string)
+	for _, item := range strings.Split(tag, ";") {
+		key, value, _ := strings.Cut(item, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			settings[strings.ToLower(key)] = strings.TrimSpace(value)
+		}
+	}
+	return settings
+}
+
+// idRule 需要生成ID的主键字段与ID策略
+type idRule struct {
+	field    *schema.Field
+	strategy string
+}
+
+// fieldKind 字段解引用指针后的类型
+func fieldKind(field *schema.Field) reflect.Kind {
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
+
+// defaultIDStrategy 未指定ID策略时按主键类型选择,标签中声明了autoIncrement的主键使用数据库自增,
+// gorm会将未声明的整数主键也视为自增,因此不能使用field.AutoIncrement判断
+func defaultIDStrategy(field *schema.Field) string {
+	if autoIncrement, ok := field.TagSettings["AUTOINCREMENT"]; ok && !strings.EqualFold(autoIncrement, "false") {
+		return IDStrategyAuto
+	}
+	switch fieldKind(field) {
+	case reflect.Int64, reflect.Uint64:
+		return IDStrategySnowflake
+	case reflect.String:
+		return IDStrategyUUID
+	default:
+		return IDStrategyAuto
+	}
+}
+
+// idRules 实体需要生成ID的主键字段,联合主键只为指定了ID策略的字段生成ID
+func idRules(s *schema.Schema) ([]idRule, error) {
+	var rules []idRule
+	for _, field := range s.PrimaryFields {
+		strategy := strings.ToLower(parseTag(field.Tag.Get("gbase"))["id"])
+		if strategy == "" {
+			if len(s.PrimaryFields) > 1 {
+				continue
+			}
+			strategy = defaultIDStrategy(field)
+		}
+		kind := fieldKind(field)
+		switch strategy {
+		case IDStrategyAuto, IDStrategyNone:
+			continue
+		case IDStrategySnowflake:
+			if kind != reflect.Int64 && kind != reflect.Uint64 && kind != reflect.String {
+				return nil, fmt.Errorf("%s.%s: 雪花ID只能用于int64、uint64或string类型的主键", s.Name, field.Name)
+			}
+		case IDStrategyUUID:
+			if kind != reflect.String {
+				return nil, fmt.Errorf("%s.%s: UUID只能用于string类型的主键", s.Name, field.Name)
+			}
+		default:
+			return nil, fmt.Errorf("%s.%s: 不支持的ID策略%s", s.Name, field.Name, strategy)
+		}
+		rules = append(rules, idRule{field: field, strategy: strategy})
+	}
+	return rules, nil
+}
+
+// nextID 按ID策略生成ID,字符串主键的雪花ID为十进制字符串
+func nextID(rule idRule) (interface{}, error) {
+	if rule.strategy == IDStrategyUUID {
+		return idgen.NextString()
+	}
+	id, err := idgen.NextID()
+	if err != nil {
+		return nil, err
+	}
+	if fieldKind(rule.field) == reflect.String {
+		return strconv.FormatInt(id, 10), nil
+	}
+	return id, nil
+}
+
+// assignIDs 为待创建的记录生成ID,支持结构体、结构体或指针的切片与数组、map及map的切片,
+// CreateInBatches每批创建时同样经过该钩子
+func assignIDs(d *gorm.DB) {
+	if d.Statement.Schema == nil || len(d.Statement.Schema.PrimaryFields) == 0 {
+		return
+	}
+	rules, err := idRules(d.Statement.Schema)
+	if err != nil {
+		_ = d.AddError(err)
+		return
+	}
+	ctx := d.Statement.Context
+	reflectValue := reflect.Indirect(d.Statement.ReflectValue)
+	switch reflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < reflectValue.Len(); i++ {
+			if err = assignElementID(ctx, reflectValue.Index(i), rules); err != nil {
+				_ = d.AddError(err)
+				return
+			}
+		}
+	default:
+		if err = assignElementID(ctx, reflectValue, rules); err != nil {
+			_ = d.AddError(err)
+		}
+	}
+}
+
+// assignElementID 为单条记录生成ID,实现了IDAssigner的实体自行设置ID,已有ID的字段不修改
+func assignElementID(ctx context.Context, elem reflect.Value, rules []idRule) error {
+	for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+		if elem.IsNil() {
+			return nil
+		}
+		elem = elem.Elem()
+	}
+	switch elem.Kind() {
+	case reflect.Map:
+		return assignMapID(elem, rules)
+	case reflect.Struct:
+	default:
+		return fmt.Errorf("元素不是结构体或map类型,无法设置ID")
+	}
+	if elem.CanAddr() {
+		if assigner, ok := elem.Addr().Interface().(IDAssigner); ok {
+			return assigner.AssignID(ctx)
+		}
+	}
+	for _, rule := range rules {
+		if _, isZero := rule.field.ValueOf(ctx, elem); !isZero {
+			continue
+		}
+		id, err := nextID(rule)
+		if err != nil {
+			return fmt.Errorf("生成ID失败: %w", err)
+		}
+		if err = rule.field.Set(ctx, elem, id); err != nil {
+			return fmt.Errorf("设置ID字段%s失败: %w", rule.field.Name, err)
+		}
+	}
+	return nil
+}
+
+// assignMapID 为map形式的记录生成ID,key可以是字段名或列名,都不存在时使用列名
+func assignMapID(m reflect.Value, rules []idRule) error {
+	if m.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+	for _, rule := range rules {
+		key := reflect.ValueOf(rule.field.DBName)
+		exists := false
+		for _, name := range []string{rule.field.Name, rule.field.DBName} {
+			value := m.MapIndex(reflect.ValueOf(name))
+			if !value.IsValid() {
+				continue
+			}
+			key = reflect.ValueOf(name)
+			if value.Kind() == reflect.Interface {
+				value = value.Elem()
+			}
+			if value.IsValid() && !value.IsZero() && !reflect.Indirect(value).IsZero() {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+		id, err := nextID(rule)
+		if err != nil {
+			return fmt.Errorf("生成ID失败: %w", err)
+		}
+		value := reflect.ValueOf(id)
+		elemType := m.Type().Elem()
+		if !value.Type().AssignableTo(elemType) {
+			if !value.Type().ConvertibleTo(elemType) {
+				return fmt.Errorf("ID字段%s的类型与map的值类型%v不匹配", rule.field.Name, elemType)
+			}
+			value = value.Convert(elemType)
+		}
+		m.SetMapIndex(key.Convert(m.Type().Key()), value)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+type snowflakeRecord struct {
+	Id   int64 `gorm:"primaryKey"`
+	Name string
+}
+
+type uuidRecord struct {
+	Id   string `gorm:"primaryKey;size:36"`
+	Name string
+}
+
+type taggedRecord struct {
+	Id   string `gorm:"primaryKey;size:20" gbase:"id=snowflake"`
+	Name string
+}
+
+type assignerRecord struct {
+	Id   int64 `gorm:"primaryKey"`
+	Name string
+}
+
+func (r *assignerRecord) AssignID(ctx context.Context) error {
+	r.Id = 42
+	return nil
+}
+
+func TestIDRules(t *testing.T) {
+	type autoIncrement struct {
+		Id int64 `gorm:"primaryKey;autoIncrement"`
+	}
+	type none struct {
+		Id int64 `gorm:"primaryKey" gbase:"id=none"`
+	}
+	type intRecord struct {
+		Id int32 `gorm:"primaryKey"`
+	}
+	type composite struct {
+		TenantId int64  `gorm:"primaryKey"`
+		Code     string `gorm:"primaryKey" gbase:"id=uuid"`
+	}
+	type badSnowflake struct {
+		Id int32 `gorm:"primaryKey" gbase:"id=snowflake"`
+	}
+	type badUUID struct {
+		Id int64 `gorm:"primaryKey" gbase:"id=uuid"`
+	}
+	type unknown struct {
+		Id int64 `gorm:"primaryKey" gbase:"id=random"`
+	}
+	tests := []struct {
+		name    string
+		model   any
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "int64 defaults to snowflake", model: &snowflakeRecord{}, want: map[string]string{"Id": IDStrategySnowflake}},
+		{name: "string defaults to uuid", model: &uuidRecord{}, want: map[string]string{"Id": IDStrategyUUID}},
+		{name: "tagged string snowflake", model: &taggedRecord{}, want: map[string]string{"Id": IDStrategySnowflake}},
+		{name: "autoIncrement", model: &autoIncrement{}, want: map[string]string{}},
+		{name: "none", model: &none{}, want: map[string]string{}},
+		{name: "int32 defaults to auto", model: &intRecord{}, want: map[string]string{}},
+		{name: "composite only tagged", model: &composite{}, want: map[string]string{"Code": IDStrategyUUID}},
+		{name: "snowflake on int32", model: &badSnowflake{}, wantErr: true},
+		{name: "uuid on int64", model: &badUUID{}, wantErr: true},
+		{name: "unknown strategy", model: &unknown{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				s, err := schema.Parse(tt.model, &sync.Map{}, schema.NamingStrategy{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				rules, err := idRules(s)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatal("expected error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make(map[string]string)
+				for _, rule := range rules {
+					got[rule.field.Name] = rule.strategy
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("rules = %v, want %v", got, tt.want)
+				}
+				for name, strategy := range tt.want {
+					if got[name] != strategy {
+						t.Fatalf("rules = %v, want %v", got, tt.want)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestAssignIDs(t *testing.T) {
+	db := openTestDB(t, nil, &snowflakeRecord{}, &uuidRecord{}, &taggedRecord{}, &assignerRecord{})
+	ctx := context.Background()
+
+	record := &snowflakeRecord{Name: "a"}
+	if err := db.WithContext(ctx).Create(record).Error; err != nil {
+		t.Fatal(err)
+	}
+	if record.Id == 0 {
+		t.Fatal("expected snowflake id")
+	}
+	existing := &snowflakeRecord{Id: 7, Name: "b"}
+	if err := db.Create(existing).Error; err != nil || existing.Id != 7 {
+		t.Fatalf("id = %d, err = %v, want existing id 7", existing.Id, err)
+	}
+
+	uuid := &uuidRecord{Name: "u"}
+	if err := db.Create(uuid).Error; err != nil || len(uuid.Id) != 36 {
+		t.Fatalf("id = %q, err = %v, want uuid", uuid.Id, err)
+	}
+	tagged := &taggedRecord{Name: "t"}
+	if err := db.Create(tagged).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strconv.ParseInt(tagged.Id, 10, 64); err != nil {
+		t.Fatalf("id = %q, want decimal snowflake id", tagged.Id)
+	}
+
+	assigner := &assignerRecord{Name: "s"}
+	if err := db.Create(assigner).Error; err != nil || assigner.Id != 42 {
+		t.Fatalf("id = %d, err = %v, want id assigned by IDAssigner", assigner.Id, err)
+	}
+
+	batch := []*snowflakeRecord{{Name: "c"}, {Id: 8, Name: "d"}, {Name: "e"}}
+	if err := db.CreateInBatches(batch, 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Id == 0 || batch[2].Id == 0 || batch[0].Id == batch[2].Id || batch[1].Id != 8 {
+		t.Fatalf("unexpected batch ids %d, %d, %d", batch[0].Id, batch[1].Id, batch[2].Id)
+	}
+
+	byColumn := map[string]interface{}{"name": "m"}
+	if err := db.Model(&snowflakeRecord{}).Create(byColumn).Error; err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := byColumn["id"].(int64); id == 0 {
+		t.Fatalf("map = %v, want generated id", byColumn)
+	}
+	maps := []map[string]interface{}{{"Name": "n", "Id": int64(9)}, {"Name": "o"}}
+	if err := db.Model(&snowflakeRecord{}).Create(&maps).Error; err != nil {
+		t.Fatal(err)
+	}
+	if maps[0]["Id"] != int64(9) || maps[0]["id"] != nil {
+		t.Fatalf("map = %v, want existing id kept", maps[0])
+	}
+	if id, _ := maps[1]["id"].(int64); id == 0 {
+		t.Fatalf("map = %v, want generated id", maps[1])
+	}
+	var count int64
+	if err := db.Model(&snowflakeRecord{}).Count(&count).Error; err != nil || count != 8 {
+		t.Fatalf("count = %d, err = %v, want 8", count, err)
+	}
+}
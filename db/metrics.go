@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+// metricsStartKey SQL开始执行的时间
+const metricsStartKey = "base:metrics_start"
+
+// sqlMetrics 数据源的SQL执行指标
+type sqlMetrics struct {
+	dataSource    string
+	slowThreshold time.Duration // 为0时不统计慢查询
+}
+
+// registerMetrics 注册SQL执行耗时、错误与慢查询指标的回调
+func registerMetrics(db *gorm.DB, dataSource string, slowThreshold time.Duration) error {
+	m := &sqlMetrics{dataSource: dataSource, slowThreshold: slowThreshold}
+	callback := db.Callback()
+	return errors.Join(
+		callback.Create().Before("*").Register("base:metrics_start", m.start),
+		callback.Create().After("*").Register("base:metrics_observe", m.observe("create")),
+		callback.Query().Before("*").Register("base:metrics_start", m.start),
+		callback.Query().After("*").Register("base:metrics_observe", m.observe("query")),
+		callback.Update().Before("*").Register("base:metrics_start", m.start),
+		callback.Update().After("*").Register("base:metrics_observe", m.observe("update")),
+		callback.Delete().Before("*").Register("base:metrics_start", m.start),
+		callback.Delete().After("*").Register("base:metrics_observe", m.observe("delete")),
+		callback.Row().Before("*").Register("base:metrics_start", m.start),
+		callback.Row().After("*").Register("base:metrics_observe", m.observe("row")),
+		callback.Raw().Before("*").Register("base:metrics_start", m.start),
+		callback.Raw().After("*").Register("base:metrics_observe", m.observe("raw")),
+	)
+}
+
+// start 记录SQL开始执行的时间
+func (m *sqlMetrics) start(d *gorm.DB) {
+	d.InstanceSet(metricsStartKey, time.Now())
+}
+
+// observe 记录SQL执行耗时,执行失败时记录错误,超过阈值时记录慢查询,DryRun不记录
+func (m *sqlMetrics) observe(operation string) func(d *gorm.DB) {
+	return func(d *gorm.DB) {
+		value, ok := d.InstanceGet(metricsStartKey)
+		if !ok || d.DryRun {
+			return
+		}
+		elapsed := time.Since(value.(time.Time))
+		labels := []string{m.dataSource, d.Statement.Table, operation}
+		prometheus.DbQueryDuration.WithLabelValues(labels...).Observe(elapsed.Seconds())
+		if d.Error != nil && !errors.Is(d.Error, gorm.ErrRecordNotFound) {
+			prometheus.DbErrorsTotal.WithLabelValues(labels...).Inc()
+		}
+		if m.slowThreshold > 0 && elapsed > m.slowThreshold {
+			prometheus.DbSlowQueriesTotal.WithLabelValues(labels...).Inc()
+		}
+	}
+}
+
+// registerStatsCollectors 注册主库与只读副本的连接池指标,包括打开、使用中、空闲的连接数与等待次数、等待时长,
+// 主库的db_name为数据源名称,只读副本为 数据源名称:replica-序号
+func (ds *dataSource) registerStatsCollectors(name string) error {
+	primary, err := ds.db.DB()
+	if err != nil {
+		return fmt.Errorf("获取底层数据库连接失败:%w", err)
+	}
+	pools := map[string]*sql.DB{name: primary}
+	if ds.resolver != nil {
+		_ = ds.resolver.Call(
+			func(connPool gorm.ConnPool) error {
+				if replica, ok := connPool.(*sql.DB); ok && replica != primary {
+					pools[fmt.Sprintf("%s:replica-%d", name, len(pools)-1)] = replica
+				}
+				return nil
+			},
+		)
+	}
+	for _, dbName := range sortedNames(pools) {
+		collector := collectors.NewDBStatsCollector(pools[dbName], dbName)
+		if err = prom.Register(collector); err != nil {
+			return fmt.Errorf("注册数据源[%s]连接池指标失败:%w", dbName, err)
+		}
+		ds.collectors = append(ds.collectors, collector)
+	}
+	return nil
+}
+
+// unregisterStatsCollectors 注销连接池指标
+func (ds *dataSource) unregisterStatsCollectors() {
+	for _, collector := range ds.collectors {
+		prom.Unregister(collector)
+	}
+	ds.collectors = nil
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+	"github.com/SUPERDBFMP/go-base/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"gorm.io/gorm"
+)
+
+// observedCount SQL执行耗时直方图中的样本数
+func observedCount(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := prometheus.DbQueryDuration.WithLabelValues(labels...).(prom.Metric).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestSqlMetrics(t *testing.T) {
+	tests := []struct {
+		dataSource    string
+		slowThreshold time.Duration
+		wantSlow      float64
+	}{
+		{dataSource: "metrics-slow", slowThreshold: time.Nanosecond, wantSlow: 3},
+		{dataSource: "metrics-fast", slowThreshold: 0, wantSlow: 0},
+	}
+	for _, test := range tests {
+		t.Run(
+			test.dataSource, func(t *testing.T) {
+				db := openSqlite(t, filepath.Join(t.TempDir(), "metrics.db"), &snowflakeRecord{})
+				if err := registerMetrics(db, test.dataSource, test.slowThreshold); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Create(&snowflakeRecord{Id: 1, Name: "a"}).Error; err != nil {
+					t.Fatal(err)
+				}
+				// 记录不存在不计入错误
+				if err := db.First(&snowflakeRecord{}, 2).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+					t.Fatalf("err = %v, want ErrRecordNotFound", err)
+				}
+				if err := db.Table("missing").Find(&[]snowflakeRecord{}).Error; err == nil {
+					t.Fatal("query on missing table should fail")
+				}
+				// DryRun不记录
+				db.Session(&gorm.Session{DryRun: true}).Create(&snowflakeRecord{Id: 2, Name: "b"})
+
+				created := []string{test.dataSource, "snowflake_records", "create"}
+				queried := []string{test.dataSource, "snowflake_records", "query"}
+				failed := []string{test.dataSource, "missing", "query"}
+				if n := observedCount(t, created...); n != 1 {
+					t.Fatalf("create samples = %d, want 1", n)
+				}
+				if n := observedCount(t, queried...); n != 1 {
+					t.Fatalf("query samples = %d, want 1", n)
+				}
+				if n := observedCount(t, failed...); n != 1 {
+					t.Fatalf("failed query samples = %d, want 1", n)
+				}
+				if n := testutil.ToFloat64(prometheus.DbErrorsTotal.WithLabelValues(queried...)); n != 0 {
+					t.Fatalf("errors = %v, want record not found excluded", n)
+				}
+				if n := testutil.ToFloat64(prometheus.DbErrorsTotal.WithLabelValues(failed...)); n != 1 {
+					t.Fatalf("errors = %v, want 1", n)
+				}
+				var slow float64
+				for _, labels := range [][]string{created, queried, failed} {
+					slow += testutil.ToFloat64(prometheus.DbSlowQueriesTotal.WithLabelValues(labels...))
+				}
+				if slow != test.wantSlow {
+					t.Fatalf("slow queries = %v, want %v", slow, test.wantSlow)
+				}
+			},
+		)
+	}
+}
+
+func TestStatsCollectors(t *testing.T) {
+	replicaPath := filepath.Join(t.TempDir(), "replica.db")
+	openSqlite(t, replicaPath)
+	useReplica(t, replicaPath)
+	openTestDB(t, &config.MySqlConfig{Replicas: []*config.MySqlReplicaConfig{{Host: "replica"}}})
+	ds := dataSources[config.DefaultDataSource]
+	if len(ds.collectors) != 2 {
+		t.Fatalf("collectors = %d, want one for the primary and one for the replica", len(ds.collectors))
+	}
+	for _, collector := range ds.collectors {
+		if n := testutil.CollectAndCount(collector, "go_sql_open_connections"); n != 1 {
+			t.Fatalf("open connections metrics = %d, want 1", n)
+		}
+	}
+
+	// 同名的连接池指标已注册时注册失败,注销后可以重新注册
+	primary, err := ds.db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var registered prom.AlreadyRegisteredError
+	for _, name := range []string{config.DefaultDataSource, config.DefaultDataSource + ":replica-0"} {
+		if err = prom.Register(collectors.NewDBStatsCollector(primary, name)); !errors.As(err, &registered) {
+			t.Fatalf("err = %v, want %s already registered", err, name)
+		}
+	}
+	ds.unregisterStatsCollectors()
+	if len(ds.collectors) != 0 {
+		t.Fatalf("collectors = %d, want 0 after unregister", len(ds.collectors))
+	}
+	if err = ds.registerStatsCollectors(config.DefaultDataSource); err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.collectors) != 2 {
+		t.Fatalf("collectors = %d, want 2 after re-register", len(ds.collectors))
+	}
+}
@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/redis"
+)
+
+// Locker 迁移锁,保证多个实例中只有一个执行迁移
+type Locker interface {
+	// Lock 获取锁,直到获取成功或ctx结束
+	Lock(ctx context.Context) error
+	// Unlock 释放锁
+	Unlock(ctx context.Context) error
+}
+
+// mySqlLocker 使用MySQL的GET_LOCK实现的迁移锁,锁与连接绑定,持有锁期间占用一个连接
+type mySqlLocker struct {
+	db   *sql.DB
+	name string
+	conn *sql.Conn
+}
+
+// NewMySqlLocker 创建使用MySQL GET_LOCK的迁移锁,name为锁名称,最长64个字符
+func NewMySqlLocker(db *sql.DB, name string) Locker {
+	return &mySqlLocker{db: db, name: name}
+}
+
+func (l *mySqlLocker) Lock(ctx context.Context) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	timeout := -1
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = max(int(time.Until(deadline).Seconds()), 0)
+	}
+	var acquired sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", l.name, timeout).Scan(&acquired); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("获取迁移锁%s失败: %w", l.name, err)
+	}
+	if acquired.Int64 != 1 {
+		_ = conn.Close()
+		return fmt.Errorf("获取迁移锁%s超时", l.name)
+	}
+	l.conn = conn
+	return nil
+}
+
+func (l *mySqlLocker) Unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return errors.New("未持有迁移锁")
+	}
+	defer func() {
+		_ = l.conn.Close()
+		l.conn = nil
+	}()
+	_, err := l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.name)
+	return err
+}
+
+// redisLocker 使用Redis分布式锁实现的迁移锁,持有锁期间自动续期
+type redisLocker struct {
+	key  string
+	lock *redis.DistributedLock
+}
+
+// NewRedisLocker 创建使用Redis分布式锁的迁移锁,需已初始化Redis
+func NewRedisLocker(key string) Locker {
+	return &redisLocker{key: key}
+}
+
+func (l *redisLocker) Lock(ctx context.Context) error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		lock := redis.NewDistributedLock(l.key, 30*time.Second)
+		acquired, err := lock.TryLock(ctx)
+		if err != nil {
+			return fmt.Errorf("获取迁移锁%s失败: %w", l.key, err)
+		}
+		if acquired {
+			l.lock = lock
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("获取迁移锁%s超时: %w", l.key, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *redisLocker) Unlock(ctx context.Context) error {
+	if l.lock == nil {
+		return errors.New("未持有迁移锁")
+	}
+	defer func() {
+		l.lock = nil
+	}()
+	return l.lock.Unlock(ctx)
+}
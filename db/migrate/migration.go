@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration 一个版本的迁移,Up与Down为该版本升级与回滚的SQL
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// fileNamePattern 迁移文件名格式,如 20240101120000_create_user.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load 从fsys的dir目录读取迁移文件并按版本排序,文件名格式为 {version}_{name}.up.sql 与 {version}_{name}.down.sql,
+// 每个版本必须有up文件,down文件可选
+func Load(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移目录%s失败: %w", dir, err)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		matches := fileNamePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("迁移文件%s的版本号不合法: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移文件%s失败: %w", entry.Name(), err)
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("版本%d存在多个迁移: %s, %s", version, migration.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("版本%d_%s缺少up迁移", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements 按语句末尾的分号拆分SQL,忽略引号与注释中的分号,连接串未开启multiStatements时需逐条执行
+func splitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	var quote rune
+	lineComment, blockComment := false, false
+	runes := []rune(sql)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case lineComment:
+			if r == '\n' {
+				lineComment = false
+				current.WriteRune(r)
+			}
+			continue
+		case blockComment:
+			if r == '*' && next == '/' {
+				blockComment = false
+				i++
+			}
+			continue
+		case quote != 0:
+			current.WriteRune(r)
+			if r == '\\' && quote != '`' && next != 0 {
+				current.WriteRune(next)
+				i++
+			} else if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case r == '-' && next == '-', r == '#':
+			lineComment = true
+		case r == '/' && next == '*':
+			blockComment = true
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			current.WriteRune(r)
+		case r == ';':
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/2_add_name.up.sql":      {Data: []byte("ALTER TABLE user ADD name VARCHAR(64);")},
+		"migrations/2_add_name.down.sql":    {Data: []byte("ALTER TABLE user DROP name;")},
+		"migrations/1_create_user.up.sql":   {Data: []byte("CREATE TABLE user (id BIGINT PRIMARY KEY);")},
+		"migrations/README.md":              {Data: []byte("ignored")},
+		"migrations/10_seed_user.up.sql":    {Data: []byte("INSERT INTO user (id) VALUES (1);")},
+		"migrations/10_seed_user.down.sql":  {Data: []byte("DELETE FROM user WHERE id = 1;")},
+		"migrations/other/3_nested.up.sql":  {Data: []byte("SELECT 1;")},
+		"migrations/11_missing_up.down.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := Load(fsys, "migrations"); err == nil {
+		t.Fatal("expected error for migration without up file")
+	}
+	delete(fsys, "migrations/11_missing_up.down.sql")
+	migrations, err := Load(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	if !reflect.DeepEqual(versions, []int64{1, 2, 10}) {
+		t.Fatalf("versions = %v, want [1 2 10]", versions)
+	}
+	if migrations[0].Name != "create_user" || migrations[0].Down != "" || migrations[1].Down == "" {
+		t.Fatalf("unexpected migrations: %+v %+v", migrations[0], migrations[1])
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- 创建表;
+CREATE TABLE user (
+  id BIGINT PRIMARY KEY, /* 主键; */
+  name VARCHAR(64) DEFAULT 'a;b'
+);
+# 初始化数据
+INSERT INTO user (id, name) VALUES (1, 'it''s;'), (2, "x\";y");
+UPDATE ` + "`user;`" + ` SET name = 'c'`
+	want := []string{
+		"CREATE TABLE user (\n  id BIGINT PRIMARY KEY, \n  name VARCHAR(64) DEFAULT 'a;b'\n)",
+		"INSERT INTO user (id, name) VALUES (1, 'it''s;'), (2, \"x\\\";y\")",
+		"UPDATE `user;` SET name = 'c'",
+	}
+	if got := splitStatements(sql); !reflect.DeepEqual(got, want) {
+		t.Fatalf("splitStatements() = %q, want %q", got, want)
+	}
+}
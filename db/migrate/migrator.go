@@ -0,0 +1,283 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/glog"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	// DefaultTable 记录已执行迁移版本的默认表名
+	DefaultTable = "schema_migrations"
+	// defaultLockTimeout 等待迁移锁的默认超时时间
+	defaultLockTimeout = time.Minute
+)
+
+// Migrator 按版本执行迁移,已执行的版本记录在迁移表中
+type Migrator struct {
+	db          *gorm.DB
+	migrations  []*Migration
+	table       string
+	locker      Locker
+	lockTimeout time.Duration
+	dryRun      bool
+}
+
+// Option 迁移选项
+type Option func(*Migrator)
+
+// WithTable 指定记录已执行版本的表,默认为schema_migrations
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithLocker 指定迁移锁,未指定时不加锁,多实例部署时需指定
+func WithLocker(locker Locker) Option {
+	return func(m *Migrator) {
+		m.locker = locker
+	}
+}
+
+// WithLockTimeout 指定等待迁移锁的超时时间,默认1分钟
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = timeout
+	}
+}
+
+// WithDryRun 只打印待执行的SQL,不执行也不记录版本
+func WithDryRun(dryRun bool) Option {
+	return func(m *Migrator) {
+		m.dryRun = dryRun
+	}
+}
+
+// New 创建迁移器,migrations通过Load读取
+func New(db *gorm.DB, migrations []*Migration, opts ...Option) *Migrator {
+	m := &Migrator{db: db, migrations: migrations, table: DefaultTable, lockTimeout: defaultLockTimeout}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// step 待执行的一次升级或回滚
+type step struct {
+	migration *Migration
+	up        bool
+}
+
+// Up 执行所有未执行的版本
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	return m.Migrate(ctx, 0)
+}
+
+// Migrate 迁移到目标版本,执行不高于目标版本且未执行的升级,并按版本从高到低回滚高于目标版本的已执行版本,
+// target为0时只执行所有未执行的升级,不回滚,数据库中有本地不存在的更高版本时(如新版本已发布后回退旧代码)保持不变
+func (m *Migrator) Migrate(ctx context.Context, target int64) ([]*Migration, error) {
+	return m.run(
+		ctx, func(applied map[int64]bool) ([]step, error) {
+			var steps []step
+			if target > 0 {
+				var err error
+				if steps, err = m.downSteps(applied, func(version int64) bool { return version > target }); err != nil {
+					return nil, err
+				}
+			}
+			for _, migration := range m.migrations {
+				if (target == 0 || migration.Version <= target) && !applied[migration.Version] {
+					steps = append(steps, step{migration: migration, up: true})
+				}
+			}
+			return steps, nil
+		},
+	)
+}
+
+// Down 按版本从高到低回滚最近执行的count个版本
+func (m *Migrator) Down(ctx context.Context, count int) ([]*Migration, error) {
+	return m.run(
+		ctx, func(applied map[int64]bool) ([]step, error) {
+			if count <= 0 {
+				return nil, nil
+			}
+			versions := sortedVersions(applied)
+			if count < len(versions) {
+				versions = versions[len(versions)-count:]
+			}
+			reverted := make(map[int64]bool, len(versions))
+			for _, version := range versions {
+				reverted[version] = true
+			}
+			return m.downSteps(applied, func(version int64) bool { return reverted[version] })
+		},
+	)
+}
+
+// Version 已执行的最高版本,没有执行过迁移时返回0
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	versions := sortedVersions(applied)
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+// downSteps 需要回滚的已执行版本,按版本从高到低排列
+func (m *Migrator) downSteps(applied map[int64]bool, revert func(version int64) bool) ([]step, error) {
+	byVersion := make(map[int64]*Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+	versions := sortedVersions(applied)
+	var steps []step
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		if !revert(version) {
+			continue
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("已执行的版本%d缺少迁移文件,无法回滚", version)
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("版本%d_%s缺少down迁移,无法回滚", version, migration.Name)
+		}
+		steps = append(steps, step{migration: migration})
+	}
+	return steps, nil
+}
+
+// run 持有迁移锁时读取已执行的版本并执行plan生成的迁移步骤,dry-run时不加锁
+func (m *Migrator) run(ctx context.Context, plan func(applied map[int64]bool) ([]step, error)) ([]*Migration, error) {
+	if m.locker != nil && !m.dryRun {
+		lockCtx, cancel := context.WithTimeout(ctx, m.lockTimeout)
+		err := m.locker.Lock(lockCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := m.locker.Unlock(context.WithoutCancel(ctx)); err != nil {
+				glog.Warnf(ctx, "释放迁移锁失败: %v", err)
+			}
+		}()
+	}
+	if !m.dryRun {
+		if err := m.ensureTable(ctx); err != nil {
+			return nil, err
+		}
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := plan(applied)
+	if err != nil {
+		return nil, err
+	}
+	executed := make([]*Migration, 0, len(steps))
+	for _, s := range steps {
+		if err = m.execute(ctx, s); err != nil {
+			return executed, err
+		}
+		executed = append(executed, s.migration)
+	}
+	return executed, nil
+}
+
+// execute 逐条执行一个版本的升级或回滚SQL并记录版本,MySQL的DDL会隐式提交,执行失败时需人工处理已执行的语句
+func (m *Migrator) execute(ctx context.Context, s step) error {
+	sql, direction := s.migration.Up, "up"
+	if !s.up {
+		sql, direction = s.migration.Down, "down"
+	}
+	statements := splitStatements(sql)
+	if m.dryRun {
+		glog.Infof(ctx, "[dry-run] 迁移版本%d_%s %s:", s.migration.Version, s.migration.Name, direction)
+		for _, statement := range statements {
+			glog.Infof(ctx, "[dry-run] %s;", statement)
+		}
+		return nil
+	}
+	db := m.writeDb(ctx)
+	for i, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf(
+				"迁移版本%d_%s %s第%d条语句执行失败,之前的语句已生效: %w", s.migration.Version, s.migration.Name, direction, i+1, err,
+			)
+		}
+	}
+	var err error
+	if s.up {
+		err = db.Exec(
+			fmt.Sprintf("INSERT INTO `%s` (version, name, applied_at) VALUES (?, ?, ?)", m.table),
+			s.migration.Version, s.migration.Name, time.Now(),
+		).Error
+	} else {
+		err = db.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE version = ?", m.table), s.migration.Version).Error
+	}
+	if err != nil {
+		return fmt.Errorf("记录迁移版本%d失败: %w", s.migration.Version, err)
+	}
+	glog.Infof(ctx, "迁移版本%d_%s %s完成", s.migration.Version, s.migration.Name, direction)
+	return nil
+}
+
+// writeDb 迁移始终使用主库,避免读写分离时从副本读取已执行的版本
+func (m *Migrator) writeDb(ctx context.Context) *gorm.DB {
+	return m.db.WithContext(ctx).Clauses(dbresolver.Write)
+}
+
+// ensureTable 创建迁移表
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	err := m.writeDb(ctx).Exec(
+		fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS `%s` ("+
+				"version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at DATETIME NOT NULL)", m.table,
+		),
+	).Error
+	if err != nil {
+		return fmt.Errorf("创建迁移表%s失败: %w", m.table, err)
+	}
+	return nil
+}
+
+// applied 已执行的版本,dry-run时迁移表可能不存在
+func (m *Migrator) applied(ctx context.Context) (map[int64]bool, error) {
+	db := m.writeDb(ctx)
+	applied := make(map[int64]bool)
+	if !db.Migrator().HasTable(m.table) {
+		return applied, nil
+	}
+	var versions []int64
+	if err := db.Raw(fmt.Sprintf("SELECT version FROM `%s`", m.table)).Scan(&versions).Error; err != nil {
+		return nil, fmt.Errorf("读取迁移表%s失败: %w", m.table, err)
+	}
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+// sortedVersions 按从低到高排序的版本
+func sortedVersions(applied map[int64]bool) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
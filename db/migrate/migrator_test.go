@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "migrate.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	migrations := []*Migration{
+		{Version: 1, Name: "create_a", Up: "CREATE TABLE a (id INTEGER PRIMARY KEY);", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "create_b", Up: "CREATE TABLE b (id INTEGER PRIMARY KEY);", Down: "DROP TABLE b;"},
+		{Version: 3, Name: "create_c", Up: "CREATE TABLE c (id INTEGER PRIMARY KEY);", Down: "DROP TABLE c;"},
+	}
+	assertVersion := func(t *testing.T, want int64) {
+		t.Helper()
+		version, err := New(db, migrations).Version(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != want {
+			t.Fatalf("version = %d, want %d", version, want)
+		}
+	}
+
+	executed, err := New(db, migrations).Up(ctx)
+	if err != nil || len(executed) != 3 {
+		t.Fatalf("executed = %d, err = %v, want all 3 versions", len(executed), err)
+	}
+
+	// 数据库的版本高于本地迁移文件时(如回退到旧代码)不回滚
+	executed, err = New(db, migrations[:2]).Migrate(ctx, 0)
+	if err != nil || len(executed) != 0 {
+		t.Fatalf("executed = %d, err = %v, want nothing for database ahead of local files", len(executed), err)
+	}
+	assertVersion(t, 3)
+	if !db.Migrator().HasTable("c") {
+		t.Fatal("table c should be kept")
+	}
+
+	// 指定目标版本时回滚更高的版本
+	executed, err = New(db, migrations).Migrate(ctx, 1)
+	if err != nil || len(executed) != 2 || executed[0].Version != 3 || executed[1].Version != 2 {
+		t.Fatalf("executed = %v, err = %v, want versions 3 and 2 rolled back", executed, err)
+	}
+	assertVersion(t, 1)
+	if db.Migrator().HasTable("b") || db.Migrator().HasTable("c") {
+		t.Fatal("tables b and c should be dropped")
+	}
+
+	executed, err = New(db, migrations).Up(ctx)
+	if err != nil || len(executed) != 2 {
+		t.Fatalf("executed = %d, err = %v, want versions 2 and 3 applied", len(executed), err)
+	}
+	assertVersion(t, 3)
+}
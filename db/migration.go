@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+	"github.com/SUPERDBFMP/go-base/db/migrate"
+	"github.com/SUPERDBFMP/go-base/glog"
+	"github.com/SUPERDBFMP/go-base/listener"
+)
+
+// defaultMigrationsDir 迁移文件的默认目录
+const defaultMigrationsDir = "migrations"
+
+func init() {
+	listener.AddTypedApplicationListener(&MigrationEventListener{})
+}
+
+// runMigrations 按数据源的migrations配置执行迁移,锁名称包含库名,不同数据源互不影响
+func runMigrations(ctx context.Context, name string, migrations fs.FS, mysqlConfig *config.MySqlConfig) error {
+	conf := mysqlConfig.Migrations
+	dir := conf.Dir
+	if dir == "" {
+		dir = defaultMigrationsDir
+	}
+	loaded, err := migrate.Load(migrations, dir)
+	if err != nil {
+		return err
+	}
+	db := Get(name)
+	if db == nil {
+		return fmt.Errorf("%w: %s", ErrDataSourceNotFound, name)
+	}
+	opts := []migrate.Option{migrate.WithDryRun(conf.DryRun)}
+	if conf.Table != "" {
+		opts = append(opts, migrate.WithTable(conf.Table))
+	}
+	lockName := "go-base:migrate:" + mysqlConfig.DbName
+	if conf.Lock == "redis" {
+		opts = append(opts, migrate.WithLocker(migrate.NewRedisLocker(lockName)))
+	} else {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return fmt.Errorf("获取底层数据库连接失败:%w", err)
+		}
+		opts = append(opts, migrate.WithLocker(migrate.NewMySqlLocker(sqlDB, lockName)))
+	}
+	if conf.LockTimeout > 0 {
+		opts = append(opts, migrate.WithLockTimeout(time.Duration(conf.LockTimeout)*time.Second))
+	}
+	executed, err := migrate.New(db, loaded, opts...).Migrate(ctx, conf.Target)
+	if err != nil {
+		return err
+	}
+	glog.Infof(ctx, "数据源[%s]迁移完成,执行了%d个版本", name, len(executed))
+	return nil
+}
+
+// MigrationEventListener 配置加载完成后执行数据库迁移
+type MigrationEventListener struct{}
+
+// GetOrder 在Redis与ID生成器初始化之后、web服务启动之前执行
+func (l *MigrationEventListener) GetOrder() int {
+	return 3
+}
+
+func (l *MigrationEventListener) OnApplicationEvent(ctx context.Context, event *listener.AppConfigLoadedEvent) {
+	configs := dataSourceConfigs()
+	for _, name := range sortedNames(configs) {
+		mysqlConfig := configs[name]
+		if mysqlConfig.Migrations == nil {
+			continue
+		}
+		if event.BootstrapConfig == nil || event.BootstrapConfig.Migrations == nil {
+			panic(fmt.Sprintf("数据源[%s]配置了migrations,但未通过WithMigrations指定迁移文件", name))
+		}
+		if err := runMigrations(ctx, name, event.BootstrapConfig.Migrations, mysqlConfig); err != nil {
+			glog.Errorf(ctx, "数据源[%s]迁移失败: %v", name, err)
+			panic(fmt.Sprintf("数据源[%s]迁移失败:%v", name, err))
+		}
+	}
+}
@@ -2,22 +2,20 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"reflect"
+	"math/rand"
 	"strings"
 	"time"
 
 	"github.com/SUPERDBFMP/go-base/config"
 	"github.com/SUPERDBFMP/go-base/glog"
 	"github.com/SUPERDBFMP/go-base/listener"
-	"github.com/SUPERDBFMP/go-base/util"
 
 	"github.com/SUPERDBFMP/gorm-plus-enhanced/gplus"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-	"gorm.io/gorm/schema"
 )
 
 // GlobalDB 全局数据库实例
@@ -26,132 +24,61 @@ var GlobalDB *gorm.DB
 func init() {
 	listener.AddTypedApplicationListener(&AppConfigLoadedEventListener{})
 	listener.AddTypedApplicationListener(&AppShutDownEventListener{})
+	listener.AddTypedApplicationListener(&ConfigChangedEventListener{})
 }
 
-// InitMysql 初始化数据库
+// InitMysql 初始化数据库,连接mysql配置的默认数据源与datasources中的所有数据源
 func InitMysql(ctx context.Context) {
-	mysqlConfig := config.GlobalConf.MySQL
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		mysqlConfig.UserName, mysqlConfig.Password, mysqlConfig.Host, mysqlConfig.Port, mysqlConfig.DbName,
-	)
-
-	gormLogger := newGormLogger()
-	gormLogger.SlowThreshold = 3000 * time.Millisecond
-	gormLogger.LogLevel = logger.LogLevel(glog.GetLogLevel(config.GlobalConf.Logger.Level))
-
-	db, err := gorm.Open(
-		mysql.Open(dsn), &gorm.Config{
-			Logger: gormLogger,
-		},
-	)
-	if err != nil {
-		panic(fmt.Sprintf("连接数据库[%s]失败,异常:%v", mysqlConfig.DbName, err))
-	}
-
-	sqlDB, err := db.DB()
-	if err != nil {
-		panic("failed to get sqlDB: " + err.Error())
+	configs := dataSourceConfigs()
+	opened := make(map[string]*dataSource, len(configs))
+	for _, name := range sortedNames(configs) {
+		ds, err := openDataSource(name, configs[name])
+		if err != nil {
+			// 关闭已连接的数据源,避免重新初始化时连接泄漏与指标重复注册
+			for _, other := range opened {
+				_ = other.close()
+			}
+			panic(fmt.Sprintf("初始化数据源[%s]失败:%v", name, err))
+		}
+		opened[name] = ds
+		glog.Infof(ctx, "Mysql datasource[%s] connected successfully!", name)
 	}
-	if err = sqlDB.Ping(); err != nil {
-		panic("failed to ping database: " + err.Error())
+	dataSourceMutex.Lock()
+	dataSources = opened
+	dataSourceMutex.Unlock()
+	if ds, ok := opened[config.DefaultDataSource]; ok {
+		GlobalDB = ds.db
+		gplus.Init(ds.db)
 	}
-	// 配置连接池
+}
+
+// configurePool 配置连接池
+func configurePool(sqlDB *sql.DB, mysqlConfig *config.MySqlConfig) {
 	sqlDB.SetMaxIdleConns(mysqlConfig.MaxIdle)                                 // 最大空闲连接数
 	sqlDB.SetMaxOpenConns(mysqlConfig.MaxConn)                                 // 最大打开连接数
 	sqlDB.SetConnMaxLifetime(time.Duration(mysqlConfig.MaxLife) * time.Minute) // 连接最大生命周期
 	sqlDB.SetConnMaxIdleTime(time.Duration(mysqlConfig.MaxIdleTime) * time.Minute)
-	GlobalDB = db
-	if err := setupGlobalIDHook(db); err != nil {
-		panic("failed to setup global ID hook: " + err.Error())
-	}
-	gplus.Init(db)
-	glog.Infof(ctx, "Mysql connected successfully!")
 }
 
-// setupGlobalIDHook 注册全局ID生成钩子
+// setupGlobalIDHook 注册全局ID生成钩子,按实体的ID策略为主键为零值的记录生成ID
 func setupGlobalIDHook(db *gorm.DB) error {
-	err := db.Callback().Create().Before("gorm:create").Register(
-		"global_gen_id", func(d *gorm.DB) {
-			if d.Statement.Schema == nil || len(d.Statement.Schema.PrimaryFields) == 0 {
-				return
-			}
-			idField := d.Statement.Schema.PrimaryFields[0]
-
-			// 获取待创建的记录（可能是单条或切片）
-			reflectValue := d.Statement.ReflectValue
-			if reflectValue.Kind() == reflect.Ptr {
-				reflectValue = reflectValue.Elem() // 解引用指针
-			}
-
-			// 处理批量创建（切片类型）
-			if reflectValue.Kind() == reflect.Slice {
-				for i := 0; i < reflectValue.Len(); i++ {
-					elem := reflectValue.Index(i)
-					if err := setIDForElement(elem, idField); err != nil {
-						_ = d.AddError(err)
-						return
-					}
-				}
-			} else {
-				// 处理单条创建（非切片类型）
-				if err := setIDForElement(reflectValue, idField); err != nil {
-					_ = d.AddError(err)
-					return
-				}
-			}
-		},
-	)
+	err := db.Callback().Create().Before("gorm:create").Register("global_gen_id", assignIDs)
 	if err != nil {
 		return fmt.Errorf("注册全局ID生成钩子失败: %w", err)
 	}
 	return nil
 }
 
-// 为单个元素设置ID（通过反射直接操作,不依赖ValueOf）
-// elem是model对象
-func setIDForElement(elem reflect.Value, idField *schema.Field) error {
-	// 确保元素是结构体（如果是指针则解引用）
-	if elem.Kind() == reflect.Ptr {
-		elem = elem.Elem()
-	}
-	if elem.Kind() != reflect.Struct {
-		return fmt.Errorf("元素不是结构体类型,无法设置ID")
-	}
-
-	// 通过字段名获取ID字段的反射值
-	idFieldValue := elem.FieldByName(idField.Name)
-	if !idFieldValue.IsValid() {
-		return fmt.Errorf("结构体中不存在ID字段: %s", idField.Name)
-	}
-	if !idFieldValue.CanSet() {
-		return fmt.Errorf("ID字段不可设置,可能是未导出字段")
-	}
-
-	// 检查ID是否为零值
-	if idFieldValue.IsZero() {
-		// 生成新ID并设置
-		newID := util.GenerateBigintID()
-		// 确保类型匹配（int64）
-		if idFieldValue.Kind() != reflect.Int64 {
-			return fmt.Errorf("ID字段类型不是int64,无法设置")
-		}
-		idFieldValue.SetInt(newID)
-		//idFieldValue.Set(reflect.Zero(idFieldValue.Type()))
-	} else {
-		// 验证已有ID的类型
-		if idFieldValue.Kind() != reflect.Int64 {
-			return fmt.Errorf("ID字段类型错误,预期int64,实际%v", idFieldValue.Kind())
-		}
-	}
-
-	return nil
-}
+// sqlLogModePlaceholder 只打印带占位符的SQL,不打印参数
+const sqlLogModePlaceholder = "placeholder"
 
 // GormLogger 实现 GORM 的 logger.Interface 接口
 type GormLogger struct {
 	LogLevel      logger.LogLevel // GORM 日志级别
 	SlowThreshold time.Duration   // 慢查询阈值
+	Mode          string          // SQL日志模式,full或placeholder
+	RedactColumns map[string]bool // full模式下需要脱敏的列名,小写
+	SampleRate    int             // 普通SQL日志的采样比例,单位为百分比
 }
 
 // newGormLogger 创建一个新的 GORM-Logrus 适配器
@@ -159,6 +86,21 @@ func newGormLogger() *GormLogger {
 	return &GormLogger{
 		LogLevel:      logger.Info,
 		SlowThreshold: 200 * time.Millisecond, // 默认慢查询阈值
+		SampleRate:    100,
+	}
+}
+
+// parseLogLevel 解析SQL日志级别,不区分大小写,无法识别时为info
+func parseLogLevel(level string) logger.LogLevel {
+	switch strings.ToUpper(level) {
+	case "SILENT":
+		return logger.Silent
+	case "ERROR":
+		return logger.Error
+	case "WARN":
+		return logger.Warn
+	default:
+		return logger.Info
 	}
 }
 
@@ -176,14 +118,27 @@ func (l *GormLogger) Info(ctx context.Context, msg string, data ...interface{})
 }
 func (l *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
 	if l.LogLevel >= logger.Warn {
-		glog.Infof(ctx, msg, data...)
+		glog.Warnf(ctx, msg, data...)
 	}
 }
 func (l *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
 	if l.LogLevel >= logger.Error {
-		glog.Infof(ctx, msg, data...)
+		glog.Errorf(ctx, msg, data...)
 	}
 }
+
+// ParamsFilter 实现 gorm.ParamsFilter,打印SQL前处理参数,placeholder模式下不代入参数,full模式下脱敏配置的列
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.Mode == sqlLogModePlaceholder {
+		return sql, nil
+	}
+	if len(l.RedactColumns) == 0 {
+		return sql, params
+	}
+	return sql, redactParams(sql, params, l.RedactColumns)
+}
+
+// Trace 执行失败的SQL打印error日志,慢查询打印warn日志,其余SQL按采样比例打印info日志
 func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
 	if l.LogLevel <= logger.Silent {
 		return
@@ -191,30 +146,36 @@ func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql
 
 	// 计算执行时间
 	elapsed := time.Since(begin)
-	// 获取 SQL 语句和影响行数
-	sql, rows := fc()
-
-	// 处理错误
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		sql = strings.ReplaceAll(sql, "\n", "")
-		sql = strings.ReplaceAll(sql, "\t", "")
-		glog.Errorf(ctx, "SQL 执行错误 %s", sql)
-		return
-	}
 
-	// 慢查询警告
-	var slow = ""
-	if l.SlowThreshold != 0 && elapsed > l.SlowThreshold {
-		//entry.Warn("慢查询警告")
-		slow = fmt.Sprintf("SLOW SQL >= %v", l.SlowThreshold)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		// 处理错误
+		if l.LogLevel >= logger.Error {
+			sql, rows := fc()
+			glog.Errorf(ctx, "SQL 执行错误 %s | rows:%v | elapsed:%dms | error:%v", compactSql(sql), rows, elapsed.Milliseconds(), err)
+		}
+	case l.SlowThreshold != 0 && elapsed > l.SlowThreshold:
+		// 慢查询警告
+		if l.LogLevel >= logger.Warn {
+			sql, rows := fc()
+			glog.Warnf(ctx, "%s | rows:%v | elapsed:%dms SLOW SQL >= %v", compactSql(sql), rows, elapsed.Milliseconds(), l.SlowThreshold)
+		}
+	case l.LogLevel >= logger.Info && l.sampled():
+		// 正常 SQL 日志
+		sql, rows := fc()
+		glog.Infof(ctx, "%s | rows:%v | elapsed:%dms", compactSql(sql), rows, elapsed.Milliseconds())
 	}
+}
 
-	// 正常 SQL 日志
-	if l.LogLevel >= logger.Info {
-		sql = strings.ReplaceAll(sql, "\n", "")
-		sql = strings.ReplaceAll(sql, "\t", "")
-		glog.Infof(ctx, "%s | rows:%v | elapsed:%dms %s", sql, rows, elapsed.Milliseconds(), slow)
-	}
+// sampled 普通SQL日志是否命中采样
+func (l *GormLogger) sampled() bool {
+	return l.SampleRate >= 100 || l.SampleRate > 0 && rand.Intn(100) < l.SampleRate
+}
+
+// compactSql 去掉SQL中的换行与制表符
+func compactSql(sql string) string {
+	sql = strings.ReplaceAll(sql, "\n", "")
+	return strings.ReplaceAll(sql, "\t", "")
 }
 
 type AppConfigLoadedEventListener struct{}
@@ -225,11 +186,75 @@ func (ace *AppConfigLoadedEventListener) GetOrder() int {
 
 func (ace *AppConfigLoadedEventListener) OnApplicationEvent(ctx context.Context, event *listener.AppConfigLoadedEvent) {
 	glog.Infof(ctx, "AppConfigLoadedEvent: %v", event.Time)
-	if config.GlobalConf.MySQL != nil {
+	if config.IsConfigured(config.MySqlDataId) || config.IsConfigured(config.DataSourcesDataId) {
 		InitMysql(ctx)
 	}
 }
 
+// poolKeys 可在运行时调整的连接池配置,其余配置变更需重启生效
+var poolKeys = map[string]bool{
+	"max-idle":      true,
+	"max-conn":      true,
+	"max-life":      true,
+	"max-idle-time": true,
+}
+
+// ConfigChangedEventListener MySQL或多数据源配置变更时调整连接池
+type ConfigChangedEventListener struct{}
+
+func (l *ConfigChangedEventListener) GetOrder() int {
+	return 0
+}
+
+func (l *ConfigChangedEventListener) OnApplicationEvent(ctx context.Context, event *listener.ConfigChangedEvent) {
+	switch event.DataId {
+	case config.MySqlDataId:
+		if mysqlConfig, ok := event.New.(*config.MySqlConfig); ok {
+			resizePool(ctx, config.DefaultDataSource, mysqlConfig, event.ChangedKeys)
+		}
+	case config.DataSourcesDataId:
+		dataSourcesConfig, ok := event.New.(*config.DataSourcesConfig)
+		if !ok {
+			return
+		}
+		// 按数据源名称拆分变化的key,如 order.max-conn
+		changedKeys := make(map[string][]string)
+		for _, key := range event.ChangedKeys {
+			name, rest, _ := strings.Cut(key, ".")
+			changedKeys[name] = append(changedKeys[name], rest)
+		}
+		for _, name := range sortedNames(changedKeys) {
+			mysqlConfig, ok := (*dataSourcesConfig)[name]
+			if !ok {
+				glog.Warnf(ctx, "数据源[%s]已删除,需重启后生效", name)
+				continue
+			}
+			resizePool(ctx, name, mysqlConfig, changedKeys[name])
+		}
+	}
+}
+
+// resizePool 调整数据源的连接池,其余配置变更仅告警
+func resizePool(ctx context.Context, name string, mysqlConfig *config.MySqlConfig, changedKeys []string) {
+	dataSourceMutex.RLock()
+	ds, ok := dataSources[name]
+	dataSourceMutex.RUnlock()
+	if !ok {
+		glog.Warnf(ctx, "数据源[%s]未初始化,配置变更需重启后生效", name)
+		return
+	}
+	for _, key := range changedKeys {
+		if !poolKeys[key] {
+			glog.Warnf(ctx, "数据源[%s]配置[%s]变更需重启后生效", name, key)
+		}
+	}
+	ds.configurePool(mysqlConfig)
+	glog.Infof(
+		ctx, "数据源[%s]连接池已调整,max-idle:%d,max-conn:%d,max-life:%d,max-idle-time:%d",
+		name, mysqlConfig.MaxIdle, mysqlConfig.MaxConn, mysqlConfig.MaxLife, mysqlConfig.MaxIdleTime,
+	)
+}
+
 type AppShutDownEventListener struct{}
 
 func (l *AppShutDownEventListener) GetOrder() int {
@@ -245,24 +270,29 @@ func (l *AppShutDownEventListener) OnApplicationEvent(ctx context.Context, event
 	}
 }
 
-// CloseDB 关闭GORM数据库连接（带上下文超时）
+// CloseDB 关闭所有数据源的数据库连接（带上下文超时）
 func CloseDB(ctx context.Context) error {
 	glog.Info(ctx, "开始关闭数据库连接...")
-	if GlobalDB == nil {
+	dataSourceMutex.Lock()
+	closing := dataSources
+	dataSources = make(map[string]*dataSource)
+	dataSourceMutex.Unlock()
+	if len(closing) == 0 {
 		glog.Info(ctx, "数据库连接未初始化,无需关闭")
 		return nil
 	}
 
-	sqlDB, err := GlobalDB.DB()
-	if err != nil {
-		return fmt.Errorf("获取底层数据库连接失败:%w", err)
-	}
-
 	// 使用带超时的上下文关闭连接
 	// 注意:sql.DB.Close()不支持直接传入ctx,这里用通道+超时模拟
 	closeChan := make(chan error, 1)
 	go func() {
-		closeChan <- sqlDB.Close()
+		var errs []error
+		for _, name := range sortedNames(closing) {
+			if err := closing[name].close(); err != nil {
+				errs = append(errs, fmt.Errorf("数据源[%s]:%w", name, err))
+			}
+		}
+		closeChan <- errors.Join(errs...)
 	}()
 
 	select {
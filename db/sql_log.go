@@ -0,0 +1,251 @@
+package db
+
+import (
+	"strings"
+)
+
+// redactedValue 脱敏后的参数
+const redactedValue = "***"
+
+// sqlKeywords 会结束当前条件的SQL关键字,其后的占位符不再属于之前的列
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "OR": true, "ON": true, "SET": true, "LIMIT": true,
+	"OFFSET": true, "ORDER": true, "BY": true, "GROUP": true, "HAVING": true, "JOIN": true, "LEFT": true,
+	"RIGHT": true, "INNER": true, "OUTER": true, "CROSS": true, "AS": true, "UPDATE": true, "DELETE": true,
+	"INTO": true, "IGNORE": true, "UNION": true, "ALL": true, "DISTINCT": true, "DUPLICATE": true,
+	"KEY": true, "ASC": true, "DESC": true, "FOR": true, "NULL": true, "TRUE": true, "FALSE": true,
+	"EXISTS": true,
+}
+
+// sqlTokenKind SQL词法单元的类型
+type sqlTokenKind int
+
+const (
+	tokenWord        sqlTokenKind = iota // 关键字或未加引号的标识符
+	tokenIdent                           // 反引号中的标识符
+	tokenLiteral                         // 数字
+	tokenPlaceholder                     // 占位符 ?
+	tokenPunct                           // 括号与逗号
+	tokenOperator                        // 比较运算符
+)
+
+// sqlToken SQL词法单元,带表名的列只保留列名
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// redactParams 将脱敏列对应的参数替换为***,返回新的参数,不修改原参数
+func redactParams(sql string, params []interface{}, columns map[string]bool) []interface{} {
+	redacted := make([]interface{}, len(params))
+	copy(redacted, params)
+	for i, column := range placeholderColumns(sql) {
+		if i < len(redacted) && columns[column] {
+			redacted[i] = redactedValue
+		}
+	}
+	return redacted
+}
+
+// placeholderColumns 按顺序返回SQL中每个占位符对应的列名(小写),无法判断时为空,
+// 支持 col = ?、col IN (?)、col BETWEEN ? AND ?、SET col = ?、CASE WHEN ... THEN ? 与 INSERT的VALUES
+func placeholderColumns(sql string) []string {
+	var (
+		columns       []string
+		depth         int
+		lastIdent     string   // 最近的标识符
+		column        string   // 当前条件的列
+		columnDepth   int      // 当前条件所在的括号层级,离开该层级时结束
+		inBetween     bool     // BETWEEN后的AND不结束条件
+		caseColumns   []string // CASE外层的列,THEN与ELSE的值属于该列
+		insertState   int      // 0 非INSERT,1 INSERT后,2 INSERT的列,3 VALUES
+		insertColumns []string
+		valueIndex    int
+	)
+	for _, token := range tokenize(sql) {
+		switch token.kind {
+		case tokenPlaceholder:
+			name := column
+			if insertState == 3 && depth == 1 && valueIndex < len(insertColumns) {
+				name = insertColumns[valueIndex]
+			}
+			columns = append(columns, name)
+		case tokenPunct:
+			switch token.text {
+			case "(":
+				depth++
+				if insertState == 1 && depth == 1 {
+					insertState = 2
+				} else if insertState == 3 && depth == 1 {
+					valueIndex = 0
+				}
+			case ")":
+				depth--
+				if insertState == 2 && depth == 0 {
+					insertState = 1
+				}
+				if depth < columnDepth {
+					column = ""
+				}
+			case ",":
+				if insertState == 3 && depth == 1 {
+					valueIndex++
+				}
+				if depth == columnDepth {
+					column = ""
+				}
+			}
+		case tokenOperator:
+			column, columnDepth = lastIdent, depth
+		case tokenIdent:
+			lastIdent = token.text
+			if insertState == 2 && depth == 1 {
+				insertColumns = append(insertColumns, token.text)
+			}
+		case tokenWord:
+			keyword := strings.ToUpper(token.text)
+			switch keyword {
+			case "IN", "LIKE", "REGEXP":
+				column, columnDepth = lastIdent, depth
+			case "BETWEEN":
+				column, columnDepth, inBetween = lastIdent, depth, true
+			case "NOT", "IS", "ESCAPE":
+			case "AND":
+				if inBetween {
+					inBetween = false
+				} else {
+					column = ""
+				}
+			case "CASE":
+				caseColumns = append(caseColumns, column)
+				column = ""
+			case "WHEN":
+				column = ""
+			case "THEN", "ELSE":
+				if len(caseColumns) > 0 {
+					column, columnDepth = caseColumns[len(caseColumns)-1], depth
+				}
+			case "END":
+				if len(caseColumns) > 0 {
+					caseColumns = caseColumns[:len(caseColumns)-1]
+				}
+				column = ""
+			case "INSERT", "REPLACE":
+				insertState, insertColumns = 1, nil
+			case "VALUES", "VALUE":
+				if insertState == 1 && depth == 0 {
+					insertState = 3
+				}
+			default:
+				if !sqlKeywords[keyword] {
+					lastIdent = strings.ToLower(token.text)
+					if insertState == 2 && depth == 1 {
+						insertColumns = append(insertColumns, lastIdent)
+					}
+					continue
+				}
+				column = ""
+				if depth == 0 && insertState != 2 && keyword != "INTO" && keyword != "IGNORE" {
+					insertState = 0
+				}
+			}
+		}
+	}
+	return columns
+}
+
+// tokenize 将SQL拆分为词法单元,跳过字符串与注释
+func tokenize(sql string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			i = skipQuoted(sql, i)
+		case c == '#' || c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+		case c == '`' || isWordChar(c) && !isDigit(c):
+			token := sqlToken{}
+			for {
+				if sql[i] == '`' {
+					end := strings.IndexByte(sql[i+1:], '`')
+					if end < 0 {
+						end = len(sql) - i - 1
+					}
+					token = sqlToken{kind: tokenIdent, text: strings.ToLower(sql[i+1 : i+1+end])}
+					i += end + 2
+				} else {
+					start := i
+					for i < len(sql) && isWordChar(sql[i]) {
+						i++
+					}
+					token = sqlToken{kind: tokenWord, text: sql[start:i]}
+				}
+				// 带表名的列,如 `user`.`name`,只保留列名
+				if i+1 < len(sql) && sql[i] == '.' && (sql[i+1] == '`' || isWordChar(sql[i+1])) {
+					i++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, token)
+		case isDigit(c):
+			start := i
+			for i < len(sql) && (isWordChar(sql[i]) || sql[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenLiteral, text: sql[start:i]})
+		case c == '?':
+			tokens = append(tokens, sqlToken{kind: tokenPlaceholder, text: "?"})
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, sqlToken{kind: tokenPunct, text: string(c)})
+			i++
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			start := i
+			for i < len(sql) && strings.IndexByte("=<>!", sql[i]) >= 0 {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenOperator, text: sql[start:i]})
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// skipQuoted 跳过从start开始的字符串,支持反斜杠转义与连续两个引号转义,返回字符串之后的位置
+func skipQuoted(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceholderColumns(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []string
+	}{
+		{
+			sql:  "SELECT * FROM `user` WHERE `user`.`phone` = ? AND (name LIKE ? OR `id_card` IN (?,?)) AND age BETWEEN ? AND ? LIMIT ?",
+			want: []string{"phone", "name", "id_card", "id_card", "age", "age", ""},
+		},
+		{
+			sql:  "INSERT INTO `user` (`id`,`phone`,`name`) VALUES (?,?,?),(?,?,?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`)",
+			want: []string{"id", "phone", "name", "id", "phone", "name"},
+		},
+		{
+			sql:  "UPDATE `user` SET `phone`=CASE WHEN `id` = ? THEN ? ELSE ? END,`version`=`version` + ? WHERE LOWER(`name`) = ? AND remark = 'a = ?'",
+			want: []string{"id", "phone", "phone", "version", "name"},
+		},
+	}
+	for _, test := range tests {
+		if got := placeholderColumns(test.sql); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("placeholderColumns(%q) = %q, want %q", test.sql, got, test.want)
+		}
+	}
+}
+
+func TestRedactParams(t *testing.T) {
+	params := []interface{}{1, "13800000000"}
+	got := redactParams("SELECT * FROM user WHERE id = ? AND PHONE = ?", params, map[string]bool{"phone": true})
+	if !reflect.DeepEqual(got, []interface{}{1, redactedValue}) || params[1] != "13800000000" {
+		t.Fatalf("redactParams() = %v, params = %v", got, params)
+	}
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/SUPERDBFMP/go-base/config"
+	"github.com/SUPERDBFMP/go-base/glog"
+
+	"gorm.io/gorm"
+)
+
+// Propagation 事务传播方式
+type Propagation int
+
+const (
+	PropagationRequired    Propagation = iota // 已有事务时加入,否则新建事务,默认方式
+	PropagationRequiresNew                    // 总是新建独立事务,已有事务不受影响
+	PropagationNested                         // 已有事务时通过保存点嵌套,失败只回滚到保存点,否则新建事务
+)
+
+// TxOption 事务选项
+type TxOption func(*txOptions)
+
+type txOptions struct {
+	propagation Propagation
+	dataSource  string
+	sqlOptions  *sql.TxOptions
+}
+
+// WithPropagation 指定事务传播方式,默认为PropagationRequired
+func WithPropagation(propagation Propagation) TxOption {
+	return func(o *txOptions) {
+		o.propagation = propagation
+	}
+}
+
+// WithTxDataSource 指定开启事务的数据源,默认为默认数据源
+func WithTxDataSource(name string) TxOption {
+	return func(o *txOptions) {
+		o.dataSource = name
+	}
+}
+
+// WithTxSqlOptions 指定事务的隔离级别与是否只读
+func WithTxSqlOptions(sqlOptions *sql.TxOptions) TxOption {
+	return func(o *txOptions) {
+		o.sqlOptions = sqlOptions
+	}
+}
+
+// txContext context中的事务,嵌套事务与外层事务共用同一个tx
+type txContext struct {
+	tx          *gorm.DB
+	dataSource  string
+	savepoints  *int // 同一个tx中已创建的保存点数量
+	afterCommit []func(ctx context.Context)
+}
+
+// txKey 按数据源区分context中的事务
+type txKey struct {
+	dataSource string
+}
+
+// currentTxKey context中最内层的事务,AfterCommit注册到该事务
+type currentTxKey struct{}
+
+// txFromContext 获取context中指定数据源的事务
+func txFromContext(ctx context.Context, dataSource string) *txContext {
+	if ctx == nil {
+		return nil
+	}
+	tc, _ := ctx.Value(txKey{dataSource: dataSource}).(*txContext)
+	return tc
+}
+
+// withTx 返回携带事务的context
+func withTx(ctx context.Context, tc *txContext) context.Context {
+	ctx = context.WithValue(ctx, txKey{dataSource: tc.dataSource}, tc)
+	return context.WithValue(ctx, currentTxKey{}, tc)
+}
+
+// DB 获取数据源在context中的事务,没有事务时返回数据源本身,数据源不存在时返回nil
+func DB(ctx context.Context, dataSource string) *gorm.DB {
+	if tc := txFromContext(ctx, dataSource); tc != nil {
+		return tc.tx
+	}
+	return Get(dataSource)
+}
+
+// Transaction 在事务中执行fn,fn中通过ctx调用的BaseDao方法自动加入该事务,
+// fn返回错误或panic时回滚,panic回滚后继续抛出,提交成功后执行AfterCommit注册的回调
+func Transaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) (err error) {
+	options := txOptions{dataSource: config.DefaultDataSource}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	current := txFromContext(ctx, options.dataSource)
+	switch {
+	case current != nil && options.propagation == PropagationRequired:
+		return fn(ctx)
+	case current != nil && options.propagation == PropagationNested:
+		return nestedTransaction(ctx, current, fn)
+	}
+	db := Get(options.dataSource)
+	if db == nil {
+		return fmt.Errorf("%w: %s", ErrDataSourceNotFound, options.dataSource)
+	}
+	tx := db.WithContext(ctx).Begin(options.sqlOptions)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	tc := &txContext{tx: tx, dataSource: options.dataSource, savepoints: new(int)}
+	// 提交后事务已结束,提交失败时也不再回滚
+	committing := false
+	defer func() {
+		if committing {
+			return
+		}
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+		if rollbackErr := tx.Rollback().Error; rollbackErr != nil {
+			glog.Errorf(ctx, "事务回滚失败:%v", rollbackErr)
+		}
+	}()
+	if err = fn(withTx(ctx, tc)); err != nil {
+		return err
+	}
+	committing = true
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	runAfterCommit(ctx, tc.afterCommit)
+	return nil
+}
+
+// nestedTransaction 在外层事务中创建保存点执行fn,失败时回滚到保存点,成功时回调并入外层事务
+func nestedTransaction(ctx context.Context, parent *txContext, fn func(ctx context.Context) error) (err error) {
+	*parent.savepoints++
+	savepoint := fmt.Sprintf("sp_%d", *parent.savepoints)
+	if err = parent.tx.SavePoint(savepoint).Error; err != nil {
+		return err
+	}
+	tc := &txContext{tx: parent.tx, dataSource: parent.dataSource, savepoints: parent.savepoints}
+	success := false
+	defer func() {
+		if success {
+			return
+		}
+		if r := recover(); r != nil {
+			parent.tx.RollbackTo(savepoint)
+			panic(r)
+		}
+		if rollbackErr := parent.tx.RollbackTo(savepoint).Error; rollbackErr != nil {
+			glog.Errorf(ctx, "事务回滚到保存点%s失败:%v", savepoint, rollbackErr)
+		}
+	}()
+	if err = fn(withTx(ctx, tc)); err != nil {
+		return err
+	}
+	success = true
+	parent.afterCommit = append(parent.afterCommit, tc.afterCommit...)
+	return nil
+}
+
+// AfterCommit 注册在ctx中最内层事务提交后执行的回调,如发布事件,事务回滚时不执行,
+// 没有事务时立即执行,回调中的ctx不携带该事务
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	tc, _ := ctx.Value(currentTxKey{}).(*txContext)
+	if tc == nil {
+		runAfterCommit(ctx, []func(ctx context.Context){fn})
+		return
+	}
+	tc.afterCommit = append(tc.afterCommit, fn)
+}
+
+// runAfterCommit 执行提交后回调,回调panic时记录日志,不影响已提交的事务与其他回调
+func runAfterCommit(ctx context.Context, hooks []func(ctx context.Context)) {
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					glog.Errorf(ctx, "事务提交后回调异常:%v", r)
+				}
+			}()
+			hook(ctx)
+		}()
+	}
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type txRecord struct {
+	Id   int64 `gorm:"primaryKey"`
+	Name string
+}
+
+func countTxRecords(t *testing.T, name string) int64 {
+	t.Helper()
+	var count int64
+	if err := Get("default").Model(&txRecord{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestTransactionRequired(t *testing.T) {
+	openTestDB(t, nil, &txRecord{})
+	dao := NewBaseDao[txRecord]()
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	// 内层事务加入外层事务,外层回滚时内层的写入一起回滚
+	err := Transaction(
+		ctx, func(ctx context.Context) error {
+			if err := Transaction(
+				ctx, func(ctx context.Context) error {
+					return dao.Insert(ctx, &txRecord{Name: "inner"})
+				},
+			); err != nil {
+				return err
+			}
+			if countTxRecords(t, "inner") != 0 {
+				t.Error("inner insert should not be visible outside the transaction")
+			}
+			return errRollback
+		},
+	)
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expect rollback error, got %v", err)
+	}
+	if count := countTxRecords(t, "inner"); count != 0 {
+		t.Fatalf("expect inner insert rolled back with outer, got %d", count)
+	}
+
+	if err = Transaction(
+		ctx, func(ctx context.Context) error {
+			return dao.Insert(ctx, &txRecord{Name: "committed"})
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if count := countTxRecords(t, "committed"); count != 1 {
+		t.Fatalf("expect committed insert, got %d", count)
+	}
+}
+
+func TestTransactionNested(t *testing.T) {
+	openTestDB(t, nil, &txRecord{})
+	dao := NewBaseDao[txRecord]()
+	errRollback := errors.New("rollback")
+
+	err := Transaction(
+		context.Background(), func(ctx context.Context) error {
+			if err := dao.Insert(ctx, &txRecord{Name: "outer"}); err != nil {
+				return err
+			}
+			err := Transaction(
+				ctx, func(ctx context.Context) error {
+					if err := dao.Insert(ctx, &txRecord{Name: "nested"}); err != nil {
+						return err
+					}
+					return errRollback
+				}, WithPropagation(PropagationNested),
+			)
+			if !errors.Is(err, errRollback) {
+				t.Errorf("expect nested rollback error, got %v", err)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outer, nested := countTxRecords(t, "outer"), countTxRecords(t, "nested"); outer != 1 || nested != 0 {
+		t.Fatalf("expect only outer insert committed, got outer %d nested %d", outer, nested)
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	openTestDB(t, nil, &txRecord{})
+	dao := NewBaseDao[txRecord]()
+	called := false
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expect panic re-raised, got %v", r)
+			}
+		}()
+		_ = Transaction(
+			context.Background(), func(ctx context.Context) error {
+				AfterCommit(ctx, func(context.Context) { called = true })
+				if err := dao.Insert(ctx, &txRecord{Name: "panic"}); err != nil {
+					return err
+				}
+				panic("boom")
+			},
+		)
+	}()
+	if count := countTxRecords(t, "panic"); count != 0 || called {
+		t.Fatalf("expect rollback without after-commit hook, got %d records, hook called %v", count, called)
+	}
+}
+
+func TestAfterCommit(t *testing.T) {
+	openTestDB(t, nil, &txRecord{})
+	ctx := context.Background()
+	var calls []string
+
+	// 回滚时不执行
+	_ = Transaction(
+		ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, func(context.Context) { calls = append(calls, "rollback") })
+			return errors.New("rollback")
+		},
+	)
+	// 嵌套事务成功时回调并入外层事务,在外层提交后执行;失败的嵌套事务的回调丢弃
+	err := Transaction(
+		ctx, func(ctx context.Context) error {
+			_ = Transaction(
+				ctx, func(ctx context.Context) error {
+					AfterCommit(ctx, func(context.Context) { calls = append(calls, "nested") })
+					return nil
+				}, WithPropagation(PropagationNested),
+			)
+			_ = Transaction(
+				ctx, func(ctx context.Context) error {
+					AfterCommit(ctx, func(context.Context) { calls = append(calls, "nested-failed") })
+					return errors.New("rollback")
+				}, WithPropagation(PropagationNested),
+			)
+			AfterCommit(ctx, func(context.Context) { calls = append(calls, "outer") })
+			if len(calls) != 0 {
+				t.Errorf("expect hooks deferred until commit, got %v", calls)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有事务时立即执行
+	AfterCommit(ctx, func(context.Context) { calls = append(calls, "immediate") })
+	if len(calls) != 3 || calls[0] != "nested" || calls[1] != "outer" || calls[2] != "immediate" {
+		t.Fatalf("unexpected after-commit calls: %v", calls)
+	}
+}
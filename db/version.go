@@ -0,0 +1,107 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrOptimisticLockConflict 按版本号更新时没有匹配的记录,记录已被其他请求修改或已删除
+var ErrOptimisticLockConflict = errors.New("optimistic lock conflict")
+
+// versionInstanceKey 更新前的版本号,更新失败时恢复实体中的版本号
+const versionInstanceKey = "base:version"
+
+// versionField 实体中标签为 gbase:"version" 的版本号字段,不存在时返回nil
+func versionField(s *schema.Schema) *schema.Field {
+	if s == nil {
+		return nil
+	}
+	for _, field := range s.Fields {
+		if _, ok := parseTag(field.Tag.Get("gbase"))["version"]; ok {
+			return field
+		}
+	}
+	return nil
+}
+
+// registerOptimisticLock 注册乐观锁回调,按实体更新时带上版本号条件并将版本号加一,没有更新到记录时返回ErrOptimisticLockConflict
+func registerOptimisticLock(db *gorm.DB) error {
+	callback := db.Callback().Update()
+	if err := callback.Before("gorm:update").Register("base:version", beforeVersionUpdate); err != nil {
+		return err
+	}
+	return callback.After("gorm:update").Register("base:version_check", afterVersionUpdate)
+}
+
+// beforeVersionUpdate 按实体更新时添加 version = ? 条件并更新为版本号加一,版本号为零值或空指针时同样添加,
+// 避免以默认值插入的记录不受乐观锁保护,按map更新且未指定版本号时更新为 version + 1
+func beforeVersionUpdate(d *gorm.DB) {
+	stmt := d.Statement
+	field := versionField(stmt.Schema)
+	if field == nil || d.Error != nil {
+		return
+	}
+	switch fieldKind(field) {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		_ = d.AddError(fmt.Errorf("%s.%s: 版本号字段必须为整数类型", stmt.Schema.Name, field.Name))
+		return
+	}
+	dest := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if !dest.IsValid() {
+		return
+	}
+	switch dest.Kind() {
+	case reflect.Map:
+		if m, ok := dest.Interface().(map[string]interface{}); ok {
+			_, byName := m[field.Name]
+			if _, byColumn := m[field.DBName]; !byName && !byColumn {
+				m[field.DBName] = gorm.Expr("? + 1", clause.Column{Name: field.DBName})
+			}
+		}
+	case reflect.Struct:
+		version, _ := field.ValueOf(stmt.Context, dest)
+		current := reflect.Indirect(reflect.ValueOf(version))
+		next := int64(1)
+		switch {
+		case !current.IsValid():
+			version = nil
+		case current.CanInt():
+			next = current.Int() + 1
+		default:
+			next = int64(current.Uint()) + 1
+		}
+		stmt.AddClause(
+			clause.Where{
+				Exprs: []clause.Expression{
+					clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version},
+				},
+			},
+		)
+		setUpdateColumn(stmt, field, next)
+		d.InstanceSet(versionInstanceKey, version)
+	}
+}
+
+// afterVersionUpdate 按版本号更新没有更新到记录时恢复实体中的版本号并返回ErrOptimisticLockConflict
+func afterVersionUpdate(d *gorm.DB) {
+	version, ok := d.InstanceGet(versionInstanceKey)
+	if !ok || d.Error != nil || d.DryRun || d.RowsAffected > 0 {
+		return
+	}
+	stmt := d.Statement
+	if field := versionField(stmt.Schema); field != nil {
+		for _, target := range []reflect.Value{reflect.Indirect(reflect.ValueOf(stmt.Dest)), stmt.ReflectValue} {
+			if target.Kind() == reflect.Struct && target.CanAddr() {
+				_ = field.Set(stmt.Context, target, version)
+			}
+		}
+	}
+	_ = d.AddError(fmt.Errorf("%w: %s", ErrOptimisticLockConflict, stmt.Table))
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type versionRecord struct {
+	Id      int64 `gorm:"primaryKey"`
+	Name    string
+	Version int64 `gbase:"version"`
+}
+
+func loadVersionRecord(t *testing.T, db *gorm.DB, id int64) versionRecord {
+	t.Helper()
+	var record versionRecord
+	if err := db.First(&record, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestOptimisticLock(t *testing.T) {
+	db := openTestDB(t, nil, &versionRecord{})
+	dao := NewBaseDao[versionRecord]()
+	ctx := context.Background()
+	record := &versionRecord{Name: "a", Version: 1}
+	if err := dao.Insert(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, stale := loadVersionRecord(t, db, record.Id), loadVersionRecord(t, db, record.Id)
+	fresh.Name = "b"
+	if err := dao.UpdateById(ctx, &fresh); err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Version != 2 || loadVersionRecord(t, db, record.Id).Version != 2 {
+		t.Fatalf("version = %d, want incremented to 2", fresh.Version)
+	}
+
+	// 版本号不匹配时没有更新到记录,返回冲突并恢复实体中的版本号
+	stale.Name = "c"
+	if err := dao.UpdateById(ctx, &stale); !errors.Is(err, ErrOptimisticLockConflict) {
+		t.Fatalf("err = %v, want ErrOptimisticLockConflict", err)
+	}
+	if stale.Version != 1 {
+		t.Fatalf("version = %d, want restored to 1", stale.Version)
+	}
+	if loaded := loadVersionRecord(t, db, record.Id); loaded.Name != "b" {
+		t.Fatalf("name = %s, want stale update rejected", loaded.Name)
+	}
+
+	// 以零值插入的记录同样按版本号更新
+	zero := &versionRecord{Name: "zero"}
+	if err := dao.Insert(ctx, zero); err != nil {
+		t.Fatal(err)
+	}
+	fresh, stale = loadVersionRecord(t, db, zero.Id), loadVersionRecord(t, db, zero.Id)
+	fresh.Name = "zero2"
+	if err := dao.UpdateById(ctx, &fresh); err != nil || fresh.Version != 1 {
+		t.Fatalf("version = %d, err = %v, want incremented to 1", fresh.Version, err)
+	}
+	stale.Name = "zero3"
+	if err := dao.UpdateById(ctx, &stale); !errors.Is(err, ErrOptimisticLockConflict) {
+		t.Fatalf("err = %v, want ErrOptimisticLockConflict for stale zero version", err)
+	}
+	if loaded := loadVersionRecord(t, db, zero.Id); loaded.Name != "zero2" || loaded.Version != 1 {
+		t.Fatalf("record = %+v, want stale update rejected", loaded)
+	}
+
+	// 按map更新时版本号加一
+	if err := db.Model(&versionRecord{}).Where("id = ?", record.Id).Updates(map[string]interface{}{"name": "d"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadVersionRecord(t, db, record.Id); loaded.Version != 3 || loaded.Name != "d" {
+		t.Fatalf("record = %+v, want version incremented by map update", loaded)
+	}
+}
+
+func TestUpdateByIdWithRetry(t *testing.T) {
+	db := openTestDB(t, nil, &versionRecord{})
+	dao := NewBaseDao[versionRecord]()
+	ctx := context.Background()
+	record := &versionRecord{Name: "a", Version: 1}
+	if err := dao.Insert(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+	// conflictOnce 第一次执行时先由其他请求修改记录,使本次更新冲突
+	conflictOnce := func(ctx context.Context, attempts *int) func(entity *versionRecord) error {
+		return func(entity *versionRecord) error {
+			*attempts++
+			if *attempts == 1 {
+				other := &versionRecord{Id: entity.Id, Name: "other", Version: entity.Version}
+				if err := dao.UpdateById(ctx, other); err != nil {
+					return err
+				}
+			}
+			entity.Name = "retried"
+			return nil
+		}
+	}
+
+	attempts := 0
+	updated, err := dao.UpdateByIdWithRetry(ctx, record.Id, 3, conflictOnce(ctx, &attempts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || updated.Version != 3 || loadVersionRecord(t, db, record.Id).Name != "retried" {
+		t.Fatalf("attempts = %d, entity = %+v, want retried once", attempts, updated)
+	}
+
+	attempts = 0
+	if _, err = dao.UpdateByIdWithRetry(ctx, record.Id, 0, conflictOnce(ctx, &attempts)); !errors.Is(err, ErrOptimisticLockConflict) || attempts != 1 {
+		t.Fatalf("attempts = %d, err = %v, want conflict without retry", attempts, err)
+	}
+
+	// 事务中重新读取的仍是同一快照,冲突时不重试
+	attempts = 0
+	err = Transaction(
+		ctx, func(ctx context.Context) error {
+			_, err := dao.UpdateByIdWithRetry(ctx, record.Id, 3, conflictOnce(ctx, &attempts))
+			return err
+		},
+	)
+	if !errors.Is(err, ErrOptimisticLockConflict) || attempts != 1 {
+		t.Fatalf("attempts = %d, err = %v, want conflict without retry in transaction", attempts, err)
+	}
+
+	if _, err = dao.UpdateByIdWithRetry(ctx, int64(-1), 3, conflictOnce(ctx, &attempts)); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("err = %v, want ErrRecordNotFound", err)
+	}
+}
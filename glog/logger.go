@@ -19,12 +19,14 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
-	"gopkg.in/yaml.v3"
 )
 
 // 全局互斥锁
 var logMutex sync.Mutex
 
+// 日志配置变更监听只注册一次
+var watchOnce sync.Once
+
 // 全局日志轮转器（用于配置变更时关闭旧实例）
 var globalRotator *DailySizeRotator
 
@@ -76,12 +78,9 @@ func (d *DailySizeRotator) todayFilename() string {
 	return fmt.Sprintf("%s-%s%s", prefix, today, ext)
 }
 
+// 解析文件名中的 ${ENV_NAME:default} 占位符（如 "logs/${POD_NAME:default}.log"）
 func (d *DailySizeRotator) filename() string {
-	podName := getEnv("POD_NAME", "default")
-	if strings.Contains(d.config.Filename, "${POD_NAME}") {
-		return strings.Replace(d.config.Filename, "${POD_NAME}", podName, -1)
-	}
-	return d.config.Filename
+	return config.ResolvePlaceholders(d.config.Filename)
 }
 
 // 重置lumberjack实例（切换到当天文件）
@@ -205,28 +204,27 @@ func InitLogger(ctx context.Context) {
 	// 设置日志级别
 	level := logrus.Level(GetLogLevel(params.Level))
 	if level < logrus.PanicLevel || level > logrus.TraceLevel {
-		logrus.Warnf("无效的日志级别: %d,使用默认级别 InfoLevel", params.Level)
+		logrus.Warnf("无效的日志级别: %s,使用默认级别 InfoLevel", params.Level)
 		level = logrus.InfoLevel
 	}
 	logrus.SetLevel(level)
 
 	Info(ctx, "init logrus success（支持每日+大小轮转）")
 
-	if config.GlobalConf.NaCos != nil {
-		// 注册配置变更处理器
-		config.RegisterConfigChangeHandler(
-			config.LoggerDataId, config.DefaultGroup, func(data string) {
-				Infof(
-					ctx, "DataId:%s,Group:%s 配置发生变更为:%s", config.LoggerDataId, config.DefaultGroup, data,
-				)
-				if err := yaml.Unmarshal([]byte(data), &config.GlobalConf.Logger); err != nil {
-					logrus.Warnf("Parse yaml config[%s] from Nacos errs: %v,ignore", data, err)
-					return
-				}
-				InitLogger(ctx) // 重新初始化日志
-			},
-		)
-	}
+	// 注册配置变更监听,日志配置变更后重新初始化日志
+	watchOnce.Do(
+		func() {
+			config.AddConfigChangeListener(
+				func(ctx context.Context, change *config.ConfigChange) {
+					if change.DataId != config.LoggerDataId {
+						return
+					}
+					Infof(ctx, "DataId:%s 配置发生变更:%v", change.DataId, change.ChangedKeys)
+					InitLogger(ctx) // 重新初始化日志
+				},
+			)
+		},
+	)
 }
 
 func GetLogLevel(level string) int32 {
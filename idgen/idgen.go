@@ -0,0 +1,84 @@
+package idgen
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator 整数ID生成器,用于int64主键
+type IDGenerator interface {
+	NextID() (int64, error)
+}
+
+// StringIDGenerator 字符串ID生成器,用于字符串主键
+type StringIDGenerator interface {
+	NextString() (string, error)
+}
+
+// UUIDv7Generator 生成按时间有序的UUIDv7,作为字符串主键时写入性能优于随机UUID
+type UUIDv7Generator struct{}
+
+func (UUIDv7Generator) NextString() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+var (
+	generatorMutex         sync.RWMutex
+	defaultGenerator       IDGenerator
+	defaultStringGenerator StringIDGenerator = UUIDv7Generator{}
+
+	fallbackOnce      sync.Once
+	fallbackGenerator IDGenerator
+)
+
+// Default 默认的整数ID生成器,Init之前使用按pod名称哈希分配机器ID的雪花ID生成器
+func Default() IDGenerator {
+	generatorMutex.RLock()
+	generator := defaultGenerator
+	generatorMutex.RUnlock()
+	if generator != nil {
+		return generator
+	}
+	fallbackOnce.Do(
+		func() {
+			fallbackGenerator, _ = NewSnowflake(PodWorkerId())
+		},
+	)
+	return fallbackGenerator
+}
+
+// SetDefault 替换默认的整数ID生成器
+func SetDefault(generator IDGenerator) {
+	generatorMutex.Lock()
+	defer generatorMutex.Unlock()
+	defaultGenerator = generator
+}
+
+// DefaultString 默认的字符串ID生成器,默认生成UUIDv7
+func DefaultString() StringIDGenerator {
+	generatorMutex.RLock()
+	defer generatorMutex.RUnlock()
+	return defaultStringGenerator
+}
+
+// SetDefaultString 替换默认的字符串ID生成器
+func SetDefaultString(generator StringIDGenerator) {
+	generatorMutex.Lock()
+	defer generatorMutex.Unlock()
+	defaultStringGenerator = generator
+}
+
+// NextID 使用默认的整数ID生成器生成ID
+func NextID() (int64, error) {
+	return Default().NextID()
+}
+
+// NextString 使用默认的字符串ID生成器生成ID
+func NextString() (string, error) {
+	return DefaultString().NextString()
+}
@@ -0,0 +1,121 @@
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	timestampBits = 41
+	workerIdBits  = 10
+	sequenceBits  = 12
+
+	// MaxWorkerId 机器ID的最大值
+	MaxWorkerId = 1<<workerIdBits - 1
+	maxSequence = 1<<sequenceBits - 1
+	maxElapsed  = 1<<timestampBits - 1
+
+	// defaultMaxBackward 时钟回拨时默认最多等待的时间
+	defaultMaxBackward = 5 * time.Millisecond
+)
+
+// DefaultEpoch 雪花ID默认的起始时间
+var DefaultEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrClockBackwards 时钟回拨超过允许等待的时间
+var ErrClockBackwards = errors.New("clock moved backwards")
+
+// Snowflake 雪花ID生成器,ID由41位毫秒时间戳、10位机器ID与12位序列号组成
+type Snowflake struct {
+	mutex       sync.Mutex
+	epoch       int64 // 起始时间,单位为毫秒
+	workerId    int64
+	maxBackward time.Duration
+	lastMs      int64
+	sequence    int64
+	now         func() time.Time
+}
+
+// SnowflakeOption 雪花ID生成器选项
+type SnowflakeOption func(*Snowflake)
+
+// WithEpoch 指定起始时间,上线后不能修改,否则可能生成重复的ID
+func WithEpoch(epoch time.Time) SnowflakeOption {
+	return func(s *Snowflake) {
+		s.epoch = epoch.UnixMilli()
+	}
+}
+
+// WithMaxBackward 指定时钟回拨时最多等待的时间,超过时生成ID返回ErrClockBackwards
+func WithMaxBackward(maxBackward time.Duration) SnowflakeOption {
+	return func(s *Snowflake) {
+		s.maxBackward = maxBackward
+	}
+}
+
+// NewSnowflake 创建雪花ID生成器,workerId取值为0到MaxWorkerId
+func NewSnowflake(workerId int64, opts ...SnowflakeOption) (*Snowflake, error) {
+	if workerId < 0 || workerId > MaxWorkerId {
+		return nil, fmt.Errorf("worker id %d out of range [0, %d]", workerId, MaxWorkerId)
+	}
+	s := &Snowflake{
+		epoch:       DefaultEpoch.UnixMilli(),
+		workerId:    workerId,
+		maxBackward: defaultMaxBackward,
+		lastMs:      -1,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// WorkerId 机器ID
+func (s *Snowflake) WorkerId() int64 {
+	return s.workerId
+}
+
+// NextID 生成ID,同一毫秒内序列号用尽时等待下一毫秒,时钟回拨不超过maxBackward时等待时钟追上
+func (s *Snowflake) NextID() (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now().UnixMilli()
+	if now < s.lastMs {
+		backward := time.Duration(s.lastMs-now) * time.Millisecond
+		if backward > s.maxBackward {
+			return 0, fmt.Errorf("%w: %v", ErrClockBackwards, backward)
+		}
+		time.Sleep(backward)
+		if now = s.now().UnixMilli(); now < s.lastMs {
+			return 0, fmt.Errorf("%w: %dms", ErrClockBackwards, s.lastMs-now)
+		}
+	}
+	if now == s.lastMs {
+		s.sequence = (s.sequence + 1) & maxSequence
+		for s.sequence == 0 && now <= s.lastMs {
+			time.Sleep(100 * time.Microsecond)
+			now = s.now().UnixMilli()
+		}
+	} else {
+		s.sequence = 0
+	}
+	elapsed := now - s.epoch
+	if elapsed < 0 || elapsed > maxElapsed {
+		return 0, fmt.Errorf("timestamp %d out of range of epoch %d", now, s.epoch)
+	}
+	s.lastMs = now
+	return elapsed<<(workerIdBits+sequenceBits) | s.workerId<<sequenceBits | s.sequence, nil
+}
+
+// NextString 生成十进制字符串形式的ID
+func (s *Snowflake) NextString() (string, error) {
+	id, err := s.NextID()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
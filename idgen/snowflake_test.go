@@ -0,0 +1,66 @@
+package idgen
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnowflakeUnique(t *testing.T) {
+	s, err := NewSnowflake(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const goroutines, perGoroutine = 8, 5000
+	ids := make(chan int64, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				id, err := s.NextID()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ids <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate id %d", id)
+		}
+		if worker := id >> sequenceBits & MaxWorkerId; worker != 7 {
+			t.Fatalf("worker id = %d, want 7", worker)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSnowflakeClockBackwards(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, _ := NewSnowflake(1, WithMaxBackward(5*time.Millisecond))
+	s.now = func() time.Time { return now }
+	first, err := s.NextID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(-time.Second)
+	if _, err = s.NextID(); !errors.Is(err, ErrClockBackwards) {
+		t.Fatalf("err = %v, want ErrClockBackwards", err)
+	}
+	now = now.Add(time.Second + time.Millisecond)
+	next, err := s.NextID()
+	if err != nil || next <= first {
+		t.Fatalf("next = %d, err = %v, want id greater than %d", next, err, first)
+	}
+	if _, err = NewSnowflake(MaxWorkerId + 1); err == nil {
+		t.Fatal("expected worker id out of range error")
+	}
+}
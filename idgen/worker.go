@@ -0,0 +1,255 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+	"github.com/SUPERDBFMP/go-base/glog"
+	"github.com/SUPERDBFMP/go-base/listener"
+	"github.com/SUPERDBFMP/go-base/redis"
+)
+
+const (
+	WorkerIdSourceConfig = "config" // 使用配置的worker-id
+	WorkerIdSourcePod    = "pod"    // 使用POD_NAME或主机名的哈希,机器较多时可能冲突
+	WorkerIdSourceRedis  = "redis"  // 从Redis租用空闲的机器ID,租约自动续期,停机时释放
+
+	// PodNameEnvKey pod名称的环境变量,未设置时使用主机名
+	PodNameEnvKey = "POD_NAME"
+
+	defaultLeaseKey = "go-base:idgen:worker"
+	// reLeaseInterval 租约失效后重新租用机器ID的最小间隔,避免Redis不可用时每次生成ID都访问Redis
+	reLeaseInterval = time.Second
+)
+
+// ErrWorkerLeaseLost Redis机器ID租约已失效且重新租用失败,此时不再生成ID,避免与租用了同一机器ID的实例重复
+var ErrWorkerLeaseLost = errors.New("worker id lease lost")
+
+var (
+	// leaseTtl 机器ID租约的有效期
+	leaseTtl = 30 * time.Second
+
+	leaseMutex sync.Mutex
+	// leased 当前使用Redis租用机器ID的生成器
+	leased *leasedGenerator
+)
+
+func init() {
+	listener.AddTypedApplicationListener(&AppConfigLoadedEventListener{})
+	listener.AddTypedApplicationListener(&AppShutDownEventListener{})
+}
+
+// PodWorkerId 按POD_NAME或主机名的哈希计算机器ID
+func PodWorkerId() int64 {
+	name := os.Getenv(PodNameEnvKey)
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum32() % (MaxWorkerId + 1))
+}
+
+// leaseWorkerId 从pod哈希对应的机器ID开始依次尝试租用空闲的机器ID
+func leaseWorkerId(ctx context.Context, leaseKey string) (int64, *redis.DistributedLock, error) {
+	start := PodWorkerId()
+	for i := int64(0); i <= MaxWorkerId; i++ {
+		workerId := (start + i) % (MaxWorkerId + 1)
+		workerLease := redis.NewDistributedLock(fmt.Sprintf("%s:%d", leaseKey, workerId), leaseTtl)
+		acquired, err := workerLease.TryLock(ctx)
+		if errors.Is(err, redis.ErrRedisNotInitialized) {
+			return 0, nil, errors.New("从Redis租用机器ID时需配置redis")
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("租用机器ID失败: %w", err)
+		}
+		if acquired {
+			return workerId, workerLease, nil
+		}
+	}
+	return 0, nil, errors.New("没有空闲的机器ID")
+}
+
+// releaseLease 释放Redis机器ID租约,失败时仅告警,租约过期后自动释放
+func releaseLease(ctx context.Context, workerLease *redis.DistributedLock) {
+	if workerLease == nil {
+		return
+	}
+	if err := workerLease.Unlock(ctx); err != nil {
+		glog.Warnf(ctx, "释放机器ID租约失败: %v", err)
+	}
+}
+
+// leasedGenerator 使用Redis租用的机器ID生成雪花ID,租约续期失败或Redis实例重建导致租约失效时重新租用机器ID,
+// 重新租用失败时返回ErrWorkerLeaseLost
+type leasedGenerator struct {
+	mutex       sync.Mutex
+	leaseKey    string
+	options     []SnowflakeOption
+	generator   *Snowflake
+	lease       *redis.DistributedLock
+	lastAttempt time.Time
+	closed      bool
+}
+
+// newLeasedGenerator 租用机器ID并创建生成器
+func newLeasedGenerator(ctx context.Context, leaseKey string, options ...SnowflakeOption) (*leasedGenerator, error) {
+	g := &leasedGenerator{leaseKey: leaseKey, options: options}
+	if err := g.reLease(ctx); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// reLease 租用新的机器ID,机器ID不变时沿用原生成器,保证同一毫秒内的序列号不重复
+func (g *leasedGenerator) reLease(ctx context.Context) error {
+	workerId, workerLease, err := leaseWorkerId(ctx, g.leaseKey)
+	if err != nil {
+		return err
+	}
+	generator := g.generator
+	if generator == nil || generator.WorkerId() != workerId {
+		if generator, err = NewSnowflake(workerId, g.options...); err != nil {
+			releaseLease(ctx, workerLease)
+			return err
+		}
+	}
+	previous := g.lease
+	g.generator, g.lease = generator, workerLease
+	releaseLease(ctx, previous)
+	return nil
+}
+
+// NextID 租约有效时生成ID,租约失效时先重新租用机器ID
+func (g *leasedGenerator) NextID() (int64, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return 0, ErrWorkerLeaseLost
+	}
+	if g.lease == nil || !g.lease.Valid() {
+		if time.Since(g.lastAttempt) < reLeaseInterval {
+			return 0, ErrWorkerLeaseLost
+		}
+		g.lastAttempt = time.Now()
+		ctx := context.Background()
+		if err := g.reLease(ctx); err != nil {
+			glog.Errorf(ctx, "机器ID租约已失效,重新租用失败: %v", err)
+			return 0, fmt.Errorf("%w: %v", ErrWorkerLeaseLost, err)
+		}
+		glog.Warnf(ctx, "机器ID租约已失效,重新租用机器ID:%d", g.generator.WorkerId())
+	}
+	return g.generator.NextID()
+}
+
+// release 释放租约,之后生成ID时返回ErrWorkerLeaseLost
+func (g *leasedGenerator) release(ctx context.Context) {
+	g.mutex.Lock()
+	workerLease := g.lease
+	g.lease, g.closed = nil, true
+	g.mutex.Unlock()
+	releaseLease(ctx, workerLease)
+}
+
+// Init 按配置初始化默认的雪花ID生成器,conf为空时按pod名称哈希分配机器ID
+func Init(ctx context.Context, conf *config.IdGenConfig) error {
+	if conf == nil {
+		conf = &config.IdGenConfig{}
+	}
+	epoch := DefaultEpoch
+	if conf.Epoch != "" {
+		var err error
+		if epoch, err = time.ParseInLocation("2006-01-02", conf.Epoch, time.UTC); err != nil {
+			return fmt.Errorf("id-gen.epoch格式错误: %w", err)
+		}
+	}
+	maxBackward := defaultMaxBackward
+	if conf.MaxBackwardMs > 0 {
+		maxBackward = time.Duration(conf.MaxBackwardMs) * time.Millisecond
+	}
+	source := conf.WorkerIdSource
+	if source == "" {
+		source = WorkerIdSourcePod
+		if conf.WorkerId != nil {
+			source = WorkerIdSourceConfig
+		}
+	}
+	options := []SnowflakeOption{WithEpoch(epoch), WithMaxBackward(maxBackward)}
+	var generator IDGenerator
+	var workerLeased *leasedGenerator
+	var workerId int64
+	switch source {
+	case WorkerIdSourceConfig:
+		if conf.WorkerId == nil {
+			return errors.New("机器ID来源为config时需配置id-gen.worker-id")
+		}
+		workerId = *conf.WorkerId
+	case WorkerIdSourcePod:
+		workerId = PodWorkerId()
+	case WorkerIdSourceRedis:
+		leaseKey := conf.LeaseKey
+		if leaseKey == "" {
+			leaseKey = defaultLeaseKey
+		}
+		var err error
+		if workerLeased, err = newLeasedGenerator(ctx, leaseKey, options...); err != nil {
+			return err
+		}
+		generator, workerId = workerLeased, workerLeased.generator.WorkerId()
+	default:
+		return fmt.Errorf("不支持的机器ID来源%s", source)
+	}
+	if generator == nil {
+		var err error
+		if generator, err = NewSnowflake(workerId, options...); err != nil {
+			return err
+		}
+	}
+	SetDefault(generator)
+	leaseMutex.Lock()
+	previous := leased
+	leased = workerLeased
+	leaseMutex.Unlock()
+	if previous != nil {
+		previous.release(ctx)
+	}
+	glog.Infof(ctx, "ID生成器初始化完成,机器ID来源:%s,机器ID:%d", source, workerId)
+	return nil
+}
+
+type AppConfigLoadedEventListener struct{}
+
+// GetOrder 在Redis初始化之后执行
+func (l *AppConfigLoadedEventListener) GetOrder() int {
+	return 2
+}
+
+func (l *AppConfigLoadedEventListener) OnApplicationEvent(ctx context.Context, event *listener.AppConfigLoadedEvent) {
+	if err := Init(ctx, config.GlobalConf.IdGen); err != nil {
+		glog.Errorf(ctx, "初始化ID生成器失败: %v", err)
+		panic(err)
+	}
+}
+
+type AppShutDownEventListener struct{}
+
+// GetOrder 在关闭Redis之前释放机器ID租约
+func (l *AppShutDownEventListener) GetOrder() int {
+	return 0
+}
+
+func (l *AppShutDownEventListener) OnApplicationEvent(ctx context.Context, event *listener.AppShutdownEvent) {
+	leaseMutex.Lock()
+	workerLeased := leased
+	leased = nil
+	leaseMutex.Unlock()
+	if workerLeased != nil {
+		workerLeased.release(ctx)
+	}
+}
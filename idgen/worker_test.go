@@ -0,0 +1,65 @@
+package idgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/config"
+	"github.com/SUPERDBFMP/go-base/listener"
+	"github.com/SUPERDBFMP/go-base/redis"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLeasedWorkerId(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	redis.InitNamed(ctx, config.DefaultRedis, &config.RedisConfig{ServerAddress: mr.Addr()})
+	previousTtl := leaseTtl
+	leaseTtl = 300 * time.Millisecond
+	t.Cleanup(
+		func() {
+			leaseTtl = previousTtl
+			(&AppShutDownEventListener{}).OnApplicationEvent(ctx, &listener.AppShutdownEvent{})
+			SetDefault(nil)
+			_ = redis.CloseRedis(ctx)
+		},
+	)
+
+	const leaseKey = "test:idgen:worker"
+	if err := Init(ctx, &config.IdGenConfig{WorkerIdSource: WorkerIdSourceRedis, LeaseKey: leaseKey}); err != nil {
+		t.Fatal(err)
+	}
+	workerOf := func(t *testing.T) int64 {
+		t.Helper()
+		id, err := NextID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id >> sequenceBits & MaxWorkerId
+	}
+	podWorker := PodWorkerId()
+	if worker := workerOf(t); worker != podWorker {
+		t.Fatalf("worker id = %d, want %d", worker, podWorker)
+	}
+
+	// 租约被其他实例抢占后续期失败,生成ID前重新租用下一个空闲的机器ID
+	mr.Set(fmt.Sprintf("%s:%d", leaseKey, podWorker), "other")
+	time.Sleep(leaseTtl / 2)
+	if worker, want := workerOf(t), (podWorker+1)%(MaxWorkerId+1); worker != want {
+		t.Fatalf("worker id after lease lost = %d, want %d", worker, want)
+	}
+
+	// Redis不可用时租约无法续期,过期后不再生成ID
+	mr.Close()
+	time.Sleep(leaseTtl + 50*time.Millisecond)
+	if _, err := NextID(); !errors.Is(err, ErrWorkerLeaseLost) {
+		t.Fatalf("err = %v, want ErrWorkerLeaseLost", err)
+	}
+	if _, err := NextID(); !errors.Is(err, ErrWorkerLeaseLost) {
+		t.Fatalf("err = %v, want ErrWorkerLeaseLost without retrying", err)
+	}
+}
@@ -39,3 +39,15 @@ type AppWebServerStoppedEvent struct {
 func (receiver *AppWebServerStoppedEvent) SupportAsync() bool {
 	return true
 }
+
+// ConfigChangedEvent 配置中心的配置段发生变更,新配置已校验并生效
+type ConfigChangedEvent struct {
+	DataId      string
+	Old         interface{} // 变更前的配置,如 *config.MySqlConfig
+	New         interface{} // 变更后的配置
+	ChangedKeys []string
+}
+
+func (receiver *ConfigChangedEvent) SupportAsync() bool {
+	return false
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"sync"
 
+	"github.com/SUPERDBFMP/go-base/config"
 	"github.com/SUPERDBFMP/go-base/glog"
 )
 
@@ -20,6 +21,22 @@ type EventPublisher struct {
 
 var globalEventPublisher = &EventPublisher{}
 
+func init() {
+	// 配置变更时发布ConfigChangedEvent
+	config.AddConfigChangeListener(
+		func(ctx context.Context, change *config.ConfigChange) {
+			PublishApplicationEvent(
+				ctx, &ConfigChangedEvent{
+					DataId:      change.DataId,
+					Old:         change.Old,
+					New:         change.New,
+					ChangedKeys: change.ChangedKeys,
+				},
+			)
+		},
+	)
+}
+
 // init 确保初始化
 func (ep *EventPublisher) init() {
 	ep.once.Do(func() {
@@ -0,0 +1,25 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// CacheRequestsTotal 定义一个计数器，用于记录缓存的读取次数，按命名空间、层级(local、redis)和结果(hit、miss)区分
+	CacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_requests_total",
+			Help: "Total number of cache lookups by tier and result.",
+		},
+		[]string{"cache", "tier", "result"},
+	)
+	// CacheLoadsTotal 定义一个计数器，用于记录缓存未命中时从数据源加载的次数，并发加载合并后只记一次
+	CacheLoadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_loads_total",
+			Help: "Total number of cache loads from the data source.",
+		},
+		[]string{"cache", "result"},
+	)
+)
@@ -0,0 +1,34 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// DbQueryDuration 定义一个直方图，用于记录SQL执行的持续时间（单位：秒），按数据源、表和操作区分
+	DbQueryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Duration of SQL statements in seconds.",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"datasource", "table", "operation"},
+	)
+	// DbErrorsTotal 定义一个计数器，用于记录SQL执行失败的次数，不包含记录不存在
+	DbErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_errors_total",
+			Help: "Total number of failed SQL statements.",
+		},
+		[]string{"datasource", "table", "operation"},
+	)
+	// DbSlowQueriesTotal 定义一个计数器，用于记录超过慢查询阈值的SQL数量
+	DbSlowQueriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_slow_queries_total",
+			Help: "Total number of SQL statements exceeding the slow threshold.",
+		},
+		[]string{"datasource", "table", "operation"},
+	)
+)
@@ -6,4 +6,11 @@ func init() {
 	_ = prometheus.Register(HttpRequestsTotal)
 	_ = prometheus.Register(HttpRequestDuration)
 	_ = prometheus.Register(HttpRequestProcessing)
+	_ = prometheus.Register(DbQueryDuration)
+	_ = prometheus.Register(DbErrorsTotal)
+	_ = prometheus.Register(DbSlowQueriesTotal)
+	_ = prometheus.Register(RedisCommandDuration)
+	_ = prometheus.Register(RedisErrorsTotal)
+	_ = prometheus.Register(CacheRequestsTotal)
+	_ = prometheus.Register(CacheLoadsTotal)
 }
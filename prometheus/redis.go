@@ -0,0 +1,26 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// RedisCommandDuration 定义一个直方图，用于记录Redis命令的持续时间（单位：秒），按实例和命令区分，管道记为pipeline
+	RedisCommandDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "redis_command_duration_seconds",
+			Help:    "Duration of Redis commands in seconds.",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"instance", "command"},
+	)
+	// RedisErrorsTotal 定义一个计数器，用于记录Redis命令失败的次数，不包含key不存在
+	RedisErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_errors_total",
+			Help: "Total number of failed Redis commands.",
+		},
+		[]string{"instance", "command"},
+	)
+)
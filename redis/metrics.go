@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/SUPERDBFMP/go-base/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	_ = prom.Register(&poolStatsCollector{})
+}
+
+// metricsHook 记录Redis实例的命令耗时与错误指标
+type metricsHook struct {
+	instance string
+}
+
+func (h *metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.observe(cmd.Name(), start, err)
+		return err
+	}
+}
+
+func (h *metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.observe("pipeline", start, err)
+		return err
+	}
+}
+
+// observe 记录命令耗时,命令失败时记录错误,key不存在不算失败
+func (h *metricsHook) observe(command string, start time.Time, err error) {
+	prometheus.RedisCommandDuration.WithLabelValues(h.instance, command).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, redis.Nil) {
+		prometheus.RedisErrorsTotal.WithLabelValues(h.instance, command).Inc()
+	}
+}
+
+var (
+	poolTotalConnsDesc = prom.NewDesc(
+		"redis_pool_total_conns", "Number of total connections in the pool.", []string{"instance"}, nil,
+	)
+	poolIdleConnsDesc = prom.NewDesc(
+		"redis_pool_idle_conns", "Number of idle connections in the pool.", []string{"instance"}, nil,
+	)
+	poolHitsDesc = prom.NewDesc(
+		"redis_pool_hits_total", "Number of times free connection was found in the pool.", []string{"instance"}, nil,
+	)
+	poolMissesDesc = prom.NewDesc(
+		"redis_pool_misses_total", "Number of times free connection was not found in the pool.", []string{"instance"}, nil,
+	)
+	poolTimeoutsDesc = prom.NewDesc(
+		"redis_pool_timeouts_total", "Number of times a wait timeout occurred.", []string{"instance"}, nil,
+	)
+	poolStaleConnsDesc = prom.NewDesc(
+		"redis_pool_stale_conns_total", "Number of stale connections removed from the pool.", []string{"instance"}, nil,
+	)
+)
+
+// poolStatsCollector 采集所有Redis实例的连接池指标,按实例名称区分
+type poolStatsCollector struct{}
+
+func (c *poolStatsCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- poolTotalConnsDesc
+	ch <- poolIdleConnsDesc
+	ch <- poolHitsDesc
+	ch <- poolMissesDesc
+	ch <- poolTimeoutsDesc
+	ch <- poolStaleConnsDesc
+}
+
+func (c *poolStatsCollector) Collect(ch chan<- prom.Metric) {
+	clientMutex.RLock()
+	snapshot := make(map[string]redis.UniversalClient, len(clients))
+	for name, client := range clients {
+		snapshot[name] = client
+	}
+	clientMutex.RUnlock()
+	for name, client := range snapshot {
+		stats := client.PoolStats()
+		ch <- prom.MustNewConstMetric(poolTotalConnsDesc, prom.GaugeValue, float64(stats.TotalConns), name)
+		ch <- prom.MustNewConstMetric(poolIdleConnsDesc, prom.GaugeValue, float64(stats.IdleConns), name)
+		ch <- prom.MustNewConstMetric(poolHitsDesc, prom.CounterValue, float64(stats.Hits), name)
+		ch <- prom.MustNewConstMetric(poolMissesDesc, prom.CounterValue, float64(stats.Misses), name)
+		ch <- prom.MustNewConstMetric(poolTimeoutsDesc, prom.CounterValue, float64(stats.Timeouts), name)
+		ch <- prom.MustNewConstMetric(poolStaleConnsDesc, prom.CounterValue, float64(stats.StaleConns), name)
+	}
+}
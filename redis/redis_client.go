@@ -2,8 +2,13 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/SUPERDBFMP/go-base/config"
@@ -17,63 +22,167 @@ import (
 
 // Client Redis客户端结构体
 type Client struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ctx    context.Context
 }
 
-var originRedisClient *redis.Client
+var (
+	clientMutex sync.RWMutex
+	clients     = make(map[string]redis.UniversalClient) // 已连接的Redis实例,key为实例名称
+)
 
 var maxRetryCount = 3
 
+// ErrRedisNotInitialized 分布式锁使用的Redis实例不存在或未初始化
+var ErrRedisNotInitialized = errors.New("redis instance not initialized")
+
+// Redis部署模式
+const (
+	modeStandalone = "standalone"
+	modeSentinel   = "sentinel"
+	modeCluster    = "cluster"
+)
+
 func init() {
 	listener.AddTypedApplicationListener(&AppConfigLoadedEventListener{})
 	listener.AddTypedApplicationListener(&AppShutDownEventListener{})
 }
 
-// InitRedis 创建新的Redis客户端
+// redisConfigs 需要连接的Redis实例,redis配置为默认实例
+func redisConfigs() map[string]*config.RedisConfig {
+	configs := make(map[string]*config.RedisConfig)
+	if config.IsConfigured(config.RedisDataId) && config.GlobalConf.Redis != nil {
+		configs[config.DefaultRedis] = config.GlobalConf.Redis
+	}
+	for name, redisConf := range config.GlobalConf.RedisInstances {
+		configs[name] = redisConf
+	}
+	return configs
+}
+
+// sortedNames 按名称排序的实例,保证初始化与关闭的顺序稳定
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitRedis 连接redis配置的默认实例与redis-instances中的所有实例
 func InitRedis(ctx context.Context) {
-	redisConf := config.GlobalConf.Redis
-	if redisConf == nil {
-		return
-	}
-	if redisConf.ServerAddress == "" {
-		panic("No found redis config address from nacos")
-	}
-	if redisConf.PoolSize == 0 {
-		redisConf.PoolSize = 10
-	}
-	if redisConf.MinIdleCones == 0 {
-		redisConf.MinIdleCones = 5
-	}
-
-	client := redis.NewClient(
-		&redis.Options{
-			Addr:         redisConf.ServerAddress,
-			Password:     redisConf.Password,
-			DB:           redisConf.DB,
-			PoolSize:     redisConf.PoolSize,
-			MinIdleConns: redisConf.MinIdleCones,
-			//DisableIdentity: true,
-			//redis集群维护迁移通知
-			MaintNotificationsConfig: &maintnotifications.Config{
-				Mode: maintnotifications.ModeDisabled,
-				//EndpointType:   maintnotifications.EndpointTypeAuto,
-				//RelaxedTimeout: 15 * time.Second,
-			},
-		},
-	)
+	configs := redisConfigs()
+	for _, name := range sortedNames(configs) {
+		InitNamed(ctx, name, configs[name])
+	}
+}
+
+// InitNamed 按部署模式创建指定名称的Redis实例,已存在同名实例时关闭旧实例
+func InitNamed(ctx context.Context, name string, redisConf *config.RedisConfig) {
+	client, err := newUniversalClient(redisConf)
+	if err != nil {
+		panic(fmt.Sprintf("创建Redis实例[%s]客户端失败:%v", name, err))
+	}
+	client.AddHook(&metricsHook{instance: name})
 
 	// 测试连接
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	_, err := client.Ping(ctx).Result()
+	_, err = client.Ping(pingCtx).Result()
 	if err != nil {
-		glog.Errorf(ctx, "无法连接到Redis: %v", err)
+		glog.Errorf(ctx, "无法连接到Redis实例[%s]: %v", name, err)
 		panic("Can't connection redis server")
 	}
 
-	originRedisClient = client
-	glog.Infof(ctx, "Redis connected successfully.")
+	clientMutex.Lock()
+	old := clients[name]
+	clients[name] = client
+	clientMutex.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	mode := redisConf.Mode
+	if mode == "" {
+		mode = modeStandalone
+	}
+	glog.Infof(ctx, "Redis[%s] connected successfully, mode: %s", name, mode)
+}
+
+// newUniversalClient 按部署模式创建单机、哨兵或集群客户端,哨兵与集群模式使用addresses,未配置时使用server-address
+func newUniversalClient(redisConf *config.RedisConfig) (redis.UniversalClient, error) {
+	addresses := redisConf.Addresses
+	if len(addresses) == 0 && redisConf.ServerAddress != "" {
+		addresses = []string{redisConf.ServerAddress}
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("No found redis config address from nacos")
+	}
+	if redisConf.Mode == modeCluster && redisConf.DB != 0 {
+		return nil, fmt.Errorf("集群模式只支持db 0,当前为%d", redisConf.DB)
+	}
+	tlsConfig, err := buildTLSConfig(redisConf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	opts := &redis.UniversalOptions{
+		Addrs:            addresses,
+		MasterName:       redisConf.MasterName,
+		Username:         redisConf.UserName,
+		Password:         redisConf.Password,
+		SentinelUsername: redisConf.SentinelUserName,
+		SentinelPassword: redisConf.SentinelPassword,
+		DB:               redisConf.DB,
+		PoolSize:         redisConf.PoolSize,
+		MinIdleConns:     redisConf.MinIdleCones,
+		TLSConfig:        tlsConfig,
+		//DisableIdentity: true,
+		//redis集群维护迁移通知
+		MaintNotificationsConfig: &maintnotifications.Config{
+			Mode: maintnotifications.ModeDisabled,
+			//EndpointType:   maintnotifications.EndpointTypeAuto,
+			//RelaxedTimeout: 15 * time.Second,
+		},
+	}
+	switch redisConf.Mode {
+	case modeSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case modeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+// buildTLSConfig 根据配置创建TLS配置,未启用时返回nil
+func buildTLSConfig(tlsConf *config.RedisTLSConfig) (*tls.Config, error) {
+	if tlsConf == nil || !tlsConf.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         tlsConf.ServerName,
+		InsecureSkipVerify: tlsConf.InsecureSkipVerify,
+	}
+	if tlsConf.CaFile != "" {
+		ca, err := os.ReadFile(tlsConf.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取Redis CA证书失败:%w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("Redis CA证书[%s]中没有有效的证书", tlsConf.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if tlsConf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsConf.CertFile, tlsConf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取Redis客户端证书失败:%w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
 }
 
 type AppConfigLoadedEventListener struct{}
@@ -84,9 +193,7 @@ func (ace *AppConfigLoadedEventListener) GetOrder() int {
 
 func (ace *AppConfigLoadedEventListener) OnApplicationEvent(ctx context.Context, event *listener.AppConfigLoadedEvent) {
 	glog.Infof(ctx, "AppConfigLoadedEvent: %v", event.Time)
-	if config.GlobalConf.Redis != nil {
-		InitRedis(ctx)
-	}
+	InitRedis(ctx)
 }
 
 type AppShutDownEventListener struct{}
@@ -97,26 +204,60 @@ func (l *AppShutDownEventListener) GetOrder() int {
 
 func (l *AppShutDownEventListener) OnApplicationEvent(ctx context.Context, event *listener.AppShutdownEvent) {
 	// 关闭Redis连接
-	if config.GlobalConf.Redis != nil {
-		redisClient := GetRedis(ctx)
-		if redisClient != nil {
-			redisClient.Close()
-			glog.Info(ctx, "Redis连接已关闭")
+	if err := CloseRedis(ctx); err != nil {
+		glog.Errorf(ctx, "Redis关闭失败:%v", err)
+	}
+}
+
+// CloseRedis 逐个关闭所有Redis实例,某个实例关闭失败不影响其他实例
+func CloseRedis(ctx context.Context) error {
+	clientMutex.Lock()
+	closing := clients
+	clients = make(map[string]redis.UniversalClient)
+	clientMutex.Unlock()
+	var errs []error
+	for _, name := range sortedNames(closing) {
+		if err := closing[name].Close(); err != nil {
+			errs = append(errs, fmt.Errorf("Redis实例[%s]:%w", name, err))
+			continue
 		}
+		glog.Infof(ctx, "Redis实例[%s]连接已关闭", name)
 	}
+	return errors.Join(errs...)
+}
+
+// universalClient 获取指定名称的Redis实例,不存在时返回nil
+func universalClient(name string) redis.UniversalClient {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+	return clients[name]
 }
 
-// GetRedis 获取Redis客户端
+// GetRedis 获取默认Redis实例的客户端
 func GetRedis(ctx context.Context) *Client {
-	if originRedisClient == nil {
+	if universalClient(config.DefaultRedis) == nil {
 		panic("Please init redis client")
 	}
+	return GetNamed(ctx, config.DefaultRedis)
+}
+
+// GetNamed 获取指定名称的Redis实例的客户端,默认实例的名称为 config.DefaultRedis,实例不存在时panic
+func GetNamed(ctx context.Context, name string) *Client {
+	client := universalClient(name)
+	if client == nil {
+		panic(fmt.Sprintf("Please init redis client [%s]", name))
+	}
 	return &Client{
-		client: originRedisClient,
+		client: client,
 		ctx:    ctx,
 	}
 }
 
+// Universal 获取底层的go-redis客户端,用于Client未封装的命令,单机、哨兵与集群模式下类型不同
+func (r *Client) Universal() redis.UniversalClient {
+	return r.client
+}
+
 // Set 设置键值对
 func (r *Client) Set(key, value string, expiration time.Duration) error {
 	return r.client.Set(r.ctx, key, value, expiration).Err()
@@ -172,25 +313,34 @@ func (r *Client) Close() error {
 
 // DistributedLock 分布式锁结构体
 type DistributedLock struct {
-	rdb        *redis.Client // Redis客户端
-	key        string        // 锁的key
-	value      string        // 锁的唯一标识（UUID）
-	expiration time.Duration // 锁的过期时间
-	ticker     *time.Ticker  // 续期定时器
-	stopChan   chan struct{} // 停止续期的信号
-	isLocked   bool          // 是否持有锁
+	rdb        redis.UniversalClient // Redis客户端
+	key        string                // 锁的key
+	value      string                // 锁的唯一标识（UUID）
+	expiration time.Duration         // 锁的过期时间
+	ticker     *time.Ticker          // 续期定时器
+	stopChan   chan struct{}         // 停止续期的信号
+	isLocked   bool                  // 是否持有锁
+
+	leaseMutex sync.Mutex
+	expireAt   time.Time // 按获取或最近一次续期成功时计算的过期时间
+	lost       bool      // 续期时发现锁已被释放或被其他客户端持有
 }
 
-// NewDistributedLock 创建分布式锁实例
+// NewDistributedLock 在默认Redis实例上创建分布式锁实例,未配置默认实例时获取锁返回ErrRedisNotInitialized,
+// 使用其他实例时通过 GetNamed(ctx, name).NewDistributedLock 创建
 func NewDistributedLock(key string, expiration time.Duration) *DistributedLock {
-	//if originRedisClient == nil {
-	//	InitRedis()
-	//	if originRedisClient == nil {
-	//		panic("Please init redis client")
-	//	}
-	//}
+	return newDistributedLock(universalClient(config.DefaultRedis), key, expiration)
+}
+
+// NewDistributedLock 在该客户端的Redis实例上创建分布式锁实例,用于将锁与其他流量分开
+func (r *Client) NewDistributedLock(key string, expiration time.Duration) *DistributedLock {
+	return newDistributedLock(r.client, key, expiration)
+}
+
+// newDistributedLock 创建分布式锁实例
+func newDistributedLock(rdb redis.UniversalClient, key string, expiration time.Duration) *DistributedLock {
 	return &DistributedLock{
-		rdb:        originRedisClient,
+		rdb:        rdb,
 		key:        key,
 		value:      uuid.New().String(), // 生成唯一UUID作为value
 		expiration: expiration,
@@ -200,7 +350,11 @@ func NewDistributedLock(key string, expiration time.Duration) *DistributedLock {
 
 // Lock 获取分布式锁
 func (l *DistributedLock) Lock(ctx context.Context) (bool, error) {
+	if l.rdb == nil {
+		return false, ErrRedisNotInitialized
+	}
 	retryCount := 0
+	start := time.Now()
 	// 使用 SetNX 方法:等价于 Redis 命令 "SET key value NX PX <expiration>"
 	// 第4个参数 expiration 直接指定过期时间（毫秒级）
 	boolCmd := l.rdb.SetNX(ctx, l.key, l.value, l.expiration)
@@ -213,8 +367,7 @@ func (l *DistributedLock) Lock(ctx context.Context) (bool, error) {
 	}
 
 	if acquired {
-		l.isLocked = true
-		l.startRenewal() // 启动自动续期
+		l.acquired(start)
 		return true, nil
 	}
 
@@ -225,6 +378,7 @@ func (l *DistributedLock) Lock(ctx context.Context) (bool, error) {
 	for {
 		select {
 		case <-l.ticker.C:
+			start = time.Now()
 			boolCmd = l.rdb.SetNX(ctx, l.key, l.value, l.expiration)
 			// 获取结果（是否成功获取锁）
 			acquired, err = boolCmd.Result()
@@ -236,8 +390,7 @@ func (l *DistributedLock) Lock(ctx context.Context) (bool, error) {
 				}
 			}
 			if acquired {
-				l.isLocked = true
-				l.startRenewal()
+				l.acquired(start)
 				return true, nil
 			}
 		}
@@ -246,6 +399,10 @@ func (l *DistributedLock) Lock(ctx context.Context) (bool, error) {
 
 // TryLock 获取分布式锁
 func (l *DistributedLock) TryLock(ctx context.Context) (bool, error) {
+	if l.rdb == nil {
+		return false, ErrRedisNotInitialized
+	}
+	start := time.Now()
 	// 使用 SetNX 方法:等价于 Redis 命令 "SET key value NX PX <expiration>"
 	// 第4个参数 expiration 直接指定过期时间（毫秒级）
 	boolCmd := l.rdb.SetNX(ctx, l.key, l.value, l.expiration)
@@ -257,8 +414,7 @@ func (l *DistributedLock) TryLock(ctx context.Context) (bool, error) {
 	}
 
 	if acquired {
-		l.isLocked = true
-		l.startRenewal() // 启动自动续期
+		l.acquired(start)
 		return true, nil
 	}
 
@@ -266,6 +422,23 @@ func (l *DistributedLock) TryLock(ctx context.Context) (bool, error) {
 	return false, nil
 }
 
+// acquired 获取锁成功后记录过期时间并启动自动续期,start为发送命令前的时间,早于Redis中的实际过期时间
+func (l *DistributedLock) acquired(start time.Time) {
+	l.isLocked = true
+	l.leaseMutex.Lock()
+	l.expireAt, l.lost = start.Add(l.expiration), false
+	l.leaseMutex.Unlock()
+	l.startRenewal() // 启动自动续期
+}
+
+// Valid 是否仍持有锁,获取或最近一次续期成功后超过过期时间、续期时发现锁已不属于当前客户端或已释放时返回false,
+// 用于续期失败时停止依赖该锁的操作
+func (l *DistributedLock) Valid() bool {
+	l.leaseMutex.Lock()
+	defer l.leaseMutex.Unlock()
+	return !l.lost && time.Now().Before(l.expireAt)
+}
+
 // Unlock 释放分布式锁
 // ctx: 上下文
 // 返回:错误信息
@@ -284,13 +457,16 @@ func (l *DistributedLock) Unlock(ctx context.Context) error {
 	`
 	// 执行脚本:KEYS[1]是锁的key,ARGV[1]是当前锁的value
 	result, err := l.rdb.Eval(ctx, script, []string{l.key}, l.value).Int64()
-	if err != nil {
-		return fmt.Errorf("释放锁失败: %w", err)
-	}
 
-	// 停止自动续期
+	// 停止自动续期,释放失败时锁到期后自动释放,无需继续续期
 	l.stopRenewal()
 	l.isLocked = false
+	l.leaseMutex.Lock()
+	l.expireAt = time.Time{}
+	l.leaseMutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("释放锁失败: %w", err)
+	}
 
 	if result == 0 {
 		return errors.New("锁已被其他客户端持有或已过期")
@@ -340,12 +516,17 @@ func (l *DistributedLock) renew(ctx context.Context) error {
 		end
 	`
 	// 执行脚本:ARGV[2]是过期时间（毫秒）
+	start := time.Now()
 	result, err := l.rdb.Eval(ctx, script, []string{l.key}, l.value, l.expiration.Milliseconds()).Int64()
 	if err != nil {
 		return fmt.Errorf("续期脚本执行失败: %w", err)
 	}
+	l.leaseMutex.Lock()
+	defer l.leaseMutex.Unlock()
 	if result == 0 {
+		l.lost = true
 		return errors.New("续期失败,锁已被释放或不属于当前客户端")
 	}
+	l.expireAt = start.Add(l.expiration)
 	return nil
 }
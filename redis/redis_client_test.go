@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUPERDBFMP/go-base/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewUniversalClient(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		conf    *config.RedisConfig
+		check   func(t *testing.T, client redis.UniversalClient)
+		wantErr bool
+	}{
+		{
+			name: "standalone",
+			conf: &config.RedisConfig{ServerAddress: "127.0.0.1:6379", UserName: "app", Password: "secret", DB: 2},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				opts := client.(*redis.Client).Options()
+				if opts.Addr != "127.0.0.1:6379" || opts.Username != "app" || opts.Password != "secret" || opts.DB != 2 {
+					t.Fatalf("unexpected options %+v", opts)
+				}
+			},
+		},
+		{
+			name: "sentinel",
+			conf: &config.RedisConfig{
+				Mode: modeSentinel, Addresses: []string{"s1:26379", "s2:26379"}, MasterName: "mymaster",
+				SentinelUserName: "sentinel", SentinelPassword: "sentinel-secret", DB: 1,
+			},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				// 哨兵模式的客户端通过哨兵发现主节点,地址为固定的FailoverClient
+				opts := client.(*redis.Client).Options()
+				if opts.Addr != "FailoverClient" || opts.DB != 1 {
+					t.Fatalf("expect failover client, got %+v", opts)
+				}
+			},
+		},
+		{
+			name: "cluster",
+			conf: &config.RedisConfig{Mode: modeCluster, Addresses: []string{"n1:6379", "n2:6379"}, PoolSize: 20},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				opts := client.(*redis.ClusterClient).Options()
+				if len(opts.Addrs) != 2 || opts.PoolSize != 20 {
+					t.Fatalf("unexpected cluster options %+v", opts)
+				}
+			},
+		},
+		{
+			name:    "cluster with db",
+			conf:    &config.RedisConfig{Mode: modeCluster, Addresses: []string{"n1:6379"}, DB: 1},
+			wantErr: true,
+		},
+		{
+			name: "tls",
+			conf: &config.RedisConfig{
+				ServerAddress: "127.0.0.1:6380",
+				TLS:           &config.RedisTLSConfig{Enabled: true, ServerName: "redis.internal"},
+			},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				tlsConfig := client.(*redis.Client).Options().TLSConfig
+				if tlsConfig == nil || tlsConfig.ServerName != "redis.internal" {
+					t.Fatalf("unexpected tls config %+v", tlsConfig)
+				}
+			},
+		},
+		{
+			name: "tls disabled",
+			conf: &config.RedisConfig{ServerAddress: "127.0.0.1:6379", TLS: &config.RedisTLSConfig{ServerName: "redis.internal"}},
+			check: func(t *testing.T, client redis.UniversalClient) {
+				if tlsConfig := client.(*redis.Client).Options().TLSConfig; tlsConfig != nil {
+					t.Fatalf("expect no tls config, got %+v", tlsConfig)
+				}
+			},
+		},
+		{
+			name: "tls invalid ca",
+			conf: &config.RedisConfig{
+				ServerAddress: "127.0.0.1:6380", TLS: &config.RedisTLSConfig{Enabled: true, CaFile: caFile},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no address",
+			conf:    &config.RedisConfig{Mode: modeSentinel, MasterName: "mymaster"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				client, err := newUniversalClient(tt.conf)
+				if tt.wantErr {
+					if err == nil {
+						_ = client.Close()
+						t.Fatal("expect error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer client.Close()
+				tt.check(t, client)
+			},
+		)
+	}
+}
+
+func TestNamedInstances(t *testing.T) {
+	ctx := context.Background()
+	t.Cleanup(func() { _ = CloseRedis(ctx) })
+	first, second := miniredis.RunT(t), miniredis.RunT(t)
+	InitNamed(ctx, "cache", &config.RedisConfig{ServerAddress: first.Addr()})
+	InitNamed(ctx, "session", &config.RedisConfig{ServerAddress: second.Addr()})
+
+	if err := GetNamed(ctx, "cache").Universal().Set(ctx, "key", "cache", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := second.Get("key"); value != "" {
+		t.Fatalf("expect instances isolated, got %q in session", value)
+	}
+
+	// 重新初始化时关闭旧客户端
+	old := GetNamed(ctx, "cache").Universal()
+	InitNamed(ctx, "cache", &config.RedisConfig{ServerAddress: second.Addr()})
+	if err := old.Ping(ctx).Err(); !errors.Is(err, redis.ErrClosed) {
+		t.Fatalf("expect old client closed, got %v", err)
+	}
+
+	// 只配置了命名实例时,默认实例上的分布式锁返回错误
+	if _, err := NewDistributedLock("lock", 0).TryLock(ctx); !errors.Is(err, ErrRedisNotInitialized) {
+		t.Fatalf("expect ErrRedisNotInitialized, got %v", err)
+	}
+
+	if err := CloseRedis(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cache", "session"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expect GetNamed(%s) to panic after close", name)
+				}
+			}()
+			GetNamed(ctx, name)
+		}()
+	}
+}
+
+func TestGetNamedUnknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic for unknown instance")
+		}
+	}()
+	GetNamed(context.Background(), "unknown")
+}
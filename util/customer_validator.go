@@ -32,25 +32,47 @@ func timeRegex(fl validator.FieldLevel) bool {
 	return reg.MatchString(fl.Field().String())
 }
 
+// customValidations 内置的自定义校验规则
+var customValidations = map[string]validator.Func{
+	"idCardNoRegex":     idCardNoRegex,
+	"mobileRegex":       mobileRegex,
+	"carLicenseNoRegex": carLicenseNoRegex,
+	"timeRegex":         timeRegex,
+}
+
+// registerValidations 注册内置及传入的自定义校验规则
+func registerValidations(v *validator.Validate, validatorMap map[string]validator.Func) error {
+	for key, value := range customValidations {
+		if err := v.RegisterValidation(key, value); err != nil {
+			return err
+		}
+	}
+	for key, value := range validatorMap {
+		if err := v.RegisterValidation(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func InitValidator(validatorMap map[string]validator.Func) {
 	// 注册自定义校验规则
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-		if err := v.RegisterValidation("idCardNoRegex", idCardNoRegex); err != nil {
-			panic(err)
-		}
-		if err := v.RegisterValidation("mobileRegex", mobileRegex); err != nil {
+		if err := registerValidations(v, validatorMap); err != nil {
 			panic(err)
 		}
-		if err := v.RegisterValidation("carLicenseNoRegex", carLicenseNoRegex); err != nil {
-			panic(err)
-		}
-		if err := v.RegisterValidation("timeRegex", timeRegex); err != nil {
-			panic(err)
-		}
-		for key, value := range validatorMap {
-			if err := v.RegisterValidation(key, value); err != nil {
-				panic(err)
-			}
-		}
 	}
 }
+
+// NewValidator 创建使用validate标签的校验器,注册与web层相同的自定义校验规则
+// tagNameFunc不为空时用于生成错误中的字段名,如使用yaml标签名
+func NewValidator(validatorMap map[string]validator.Func, tagNameFunc validator.TagNameFunc) (*validator.Validate, error) {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	if tagNameFunc != nil {
+		v.RegisterTagNameFunc(tagNameFunc)
+	}
+	if err := registerValidations(v, validatorMap); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -7,6 +7,9 @@ import (
 	"time"
 )
 
+// GenerateBigintID 使用毫秒时间与两位随机数生成ID,高并发与多实例下容易重复
+//
+// Deprecated: 使用 idgen.NextID 生成雪花ID
 func GenerateBigintID() int64 {
 	currentTime := time.Now().Format("20060102150405.000")
 	timePart := currentTime[:14] + currentTime[15:] // 移除小数点,得到17位时间